@@ -0,0 +1,88 @@
+package reticulum
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// TrainMiniBatch runs the samples of the batch through the network in one
+// forward and one backward pass and updates the parameters once with the
+// gradients averaged over the batch. The network must be a BatchNetwork whose
+// layers all support batches. The samples are trained on their targets as
+// with TargetLossFunc and must have input volumes of the same dimensions. The
+// update includes the gradients of samples trained with Train since the last
+// update. The cost loss of the results is the mean loss of the batch.
+//
+// Only fully connected, dropout and activation layers are vectorized over
+// the batch. Convolution, pool and loss layers still run once per sample, see
+// BatchNetwork for the layers which are not supported at all.
+func (t *trainer) TrainMiniBatch(batch []Sample) (TrainingResults, error) {
+	net, ok := t.net.(BatchNetwork)
+	if !ok {
+		return TrainingResults{}, errors.New("network does not support batches")
+	} else if len(batch) == 0 {
+		return TrainingResults{}, errors.New("mini-batch cannot be empty")
+	}
+
+	vols := make([]*volume.Volume, len(batch))
+	targets := make([]Target, len(batch))
+	for i, s := range batch {
+		if s.Input == nil {
+			return TrainingResults{}, fmt.Errorf("sample %d has no input volume", i)
+		} else if dim := batch[0].Input.Dimensions(); s.Input.Dimensions() != dim {
+			return TrainingResults{}, fmt.Errorf("invalid dimensions for sample %d: %v != %v", i, s.Input.Dimensions(), dim)
+		}
+		vols[i], targets[i] = s.Input, s.Target
+	}
+	head, err := headLayer(t.net)
+	if err != nil {
+		return TrainingResults{}, err
+	}
+	for i, target := range targets {
+		if !acceptsTarget(head, target) {
+			return TrainingResults{}, fmt.Errorf("%s layer does not accept the target of sample %d", head.Type(), i)
+		}
+	}
+
+	start := time.Now()
+	if _, err := net.ForwardBatch(volume.BatchOf(vols...), true); err != nil {
+		return TrainingResults{}, err
+	}
+	fwdTime := time.Now().Sub(start)
+
+	start = time.Now()
+	costLoss := net.BackwardBatch(targets) / float64(len(batch))
+	bwdTime := time.Now().Sub(start)
+
+	// the rate of the last sample of the batch as with Train
+	t.k += len(batch) - 1
+	lr := t.learningRate()
+	t.lr = lr
+	t.k++
+	t.pending += len(batch)
+	l1DecayLoss, l2DecayLoss := t.update(lr, t.pending)
+
+	results := TrainingResults{
+		ForwardTime:  fwdTime,
+		BackwardTime: bwdTime,
+		L1DecayLoss:  l1DecayLoss,
+		L2DecayLoss:  l2DecayLoss,
+		CostLost:     costLoss,
+		TotalLoss:    costLoss + l1DecayLoss + l2DecayLoss,
+		LearningRate: lr,
+	}
+	for _, cb := range t.opts.Callbacks {
+		cb.OnBatchEnd(t.net, results)
+	}
+	return results, nil
+}
+
+// trainMiniBatch trains the batch with TrainMiniBatch and returns the sum of
+// the losses of its samples.
+func (t *trainer) trainMiniBatch(batch []Sample, loss func(Target) LossFunc) (float64, error) {
+	results, err := t.TrainMiniBatch(batch)
+	return results.CostLost * float64(len(batch)), err
+}
@@ -0,0 +1,163 @@
+package reticulum
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func batchNetwork(t testing.TB, hidden layers.LayerDef) Network {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(4, 4, 2)},
+		{Type: layers.Conv, Activation: layers.ReLU, LayerConfig: layers.NewConvLayerConfig(3, layers.WithSx(3), layers.WithPadding(1))},
+		hidden,
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(3)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+	seedWeights(net, 3)
+	return net
+}
+
+// miniBatch creates samples with inputs of the dimensions of batchNetwork.
+func miniBatch(n int) []Sample {
+	var batch []Sample
+	for i := 0; i < n; i++ {
+		vol := volume.NewVolume(volume.NewDimensions(4, 4, 2), volume.WithZeros())
+		for j := 0; j < vol.Size(); j++ {
+			vol.SetByIndex(j, math.Sin(float64(i*vol.Size()+j)))
+		}
+		batch = append(batch, Sample{
+			Input:  vol,
+			Target: Target{Label: i % 3},
+		})
+	}
+	return batch
+}
+
+func TestTrainer_TrainMiniBatch(t *testing.T) {
+	batch := miniBatch(6)
+	hidden := map[string]layers.LayerDef{
+		"fc":      {Type: layers.FullyConnected, Activation: layers.Sigmoid, LayerConfig: layers.NewFullyConnectedLayerConfig(5)},
+		"pool":    {Type: layers.Pool, LayerConfig: layers.NewPoolLayerConfig(2)},
+		"dropout": {Type: layers.Dropout, LayerConfig: &layers.DropoutLayerConfig{DropoutProbability: 0.3}},
+	}
+
+	// the batched update must match the sequential update of the same batch
+	for name, def := range hidden {
+		t.Run(name, func(t *testing.T) {
+			opts := []OptionFunc{WithMethod(Adam), WithDecay(1e-3, 1e-3), WithSchedule(StepDecay(2, 0.5)), WithSeed(5)}
+			serial := NewTrainer(batchNetwork(t, def), append(opts, WithBatchSize(len(batch)))...)
+			batched := NewTrainer(batchNetwork(t, def), opts...)
+			for step := 0; step < 3; step++ {
+				var want TrainingResults
+				var cost float64
+				for _, s := range batch {
+					want = serial.Train(s.Input, TargetLossFunc(s.Target))
+					cost += want.CostLost
+				}
+				results, err := batched.TrainMiniBatch(batch)
+				if err != nil {
+					t.Fatalf("TrainMiniBatch() error = %v", err)
+				} else if math.Abs(results.CostLost-cost/float64(len(batch))) > 1e-12 {
+					t.Errorf("CostLost = %v, want %v", results.CostLost, cost/float64(len(batch)))
+				} else if results.LearningRate != want.LearningRate {
+					t.Errorf("LearningRate = %v, want %v", results.LearningRate, want.LearningRate)
+				}
+			}
+
+			ws := flattenParams(serial.(*trainer).net.GetResponse())
+			wb := flattenParams(batched.(*trainer).net.GetResponse())
+			for i := range ws {
+				if math.Abs(ws[i]-wb[i]) > 1e-12 {
+					t.Fatalf("weight %d = %v, want %v", i, wb[i], ws[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrainer_TrainMiniBatchErrors(t *testing.T) {
+	hidden := layers.LayerDef{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(5)}
+	mixed := miniBatch(2)
+	mixed[1].Input = volume.NewVolume(volume.NewDimensions(1, 1, 32), volume.WithZeros())
+	small := miniBatch(2)
+	for i := range small {
+		small[i].Input = volume.NewVolume(volume.NewDimensions(1, 1, 32), volume.WithZeros())
+	}
+	named := miniBatch(1)
+	named[0].Input, named[0].Inputs = nil, map[string]*volume.Volume{"input": miniBatch(1)[0].Input}
+
+	batches := map[string][]Sample{
+		"empty":      nil,
+		"mixed":      mixed,
+		"dimensions": small,
+		"inputs":     named,
+	}
+	for name, batch := range batches {
+		if _, err := NewTrainer(batchNetwork(t, hidden)).TrainMiniBatch(batch); err == nil {
+			t.Errorf("TrainMiniBatch() with %s samples succeeded, want error", name)
+		}
+	}
+
+	maxout := layers.LayerDef{Type: layers.Maxout, LayerConfig: &layers.MaxoutLayerConfig{GroupSize: 3}}
+	if _, err := NewTrainer(batchNetwork(t, maxout)).TrainMiniBatch(miniBatch(2)); err == nil {
+		t.Error("TrainMiniBatch() with a maxout layer succeeded, want error")
+	}
+}
+
+func TestTrainer_FitMiniBatches(t *testing.T) {
+	var inputs []*volume.Volume
+	var targets []Target
+	for _, s := range miniBatch(10) {
+		inputs, targets = append(inputs, s.Input), append(targets, s.Target)
+	}
+	data := NewDataset(inputs, targets)
+
+	// batches of 4 samples and a last batch of 2, as with Train
+	def := layers.LayerDef{Type: layers.Pool, LayerConfig: layers.NewPoolLayerConfig(2)}
+	serial := NewTrainer(batchNetwork(t, def), WithMethod(Adam), WithBatchSize(4))
+	want, err := serial.Fit(context.Background(), data, data, 2, WithoutShuffle())
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	batched := NewTrainer(batchNetwork(t, def), WithMethod(Adam), WithBatchSize(4))
+	got, err := batched.Fit(context.Background(), data, data, 2, WithoutShuffle(), WithMiniBatches())
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	for i := range want {
+		if math.Abs(got[i].Loss-want[i].Loss) > 1e-12 || math.Abs(got[i].ValLoss-want[i].ValLoss) > 1e-12 {
+			t.Errorf("epoch %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func BenchmarkTrainer_Train(b *testing.B) {
+	batch := miniBatch(32)
+	hidden := layers.LayerDef{Type: layers.FullyConnected, Activation: layers.ReLU, LayerConfig: layers.NewFullyConnectedLayerConfig(64)}
+	trainer := NewTrainer(batchNetwork(b, hidden), WithBatchSize(len(batch)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range batch {
+			trainer.Train(s.Input, TargetLossFunc(s.Target))
+		}
+	}
+}
+
+func BenchmarkTrainer_TrainMiniBatch(b *testing.B) {
+	batch := miniBatch(32)
+	hidden := layers.LayerDef{Type: layers.FullyConnected, Activation: layers.ReLU, LayerConfig: layers.NewFullyConnectedLayerConfig(64)}
+	trainer := NewTrainer(batchNetwork(b, hidden))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := trainer.TrainMiniBatch(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package reticulum
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Callback is notified by the trainer as training progresses.
+type Callback interface {
+	// OnBatchEnd is called after every update of the parameters with the
+	// results of the last iteration of the batch.
+	OnBatchEnd(net Network, results TrainingResults)
+
+	// OnEpochEnd is called by Fit after every epoch. Training stops after
+	// the epoch if any callback returns true.
+	OnEpochEnd(net Network, results EpochResults) (stop bool)
+
+	// OnTrainEnd is called when Fit returns.
+	OnTrainEnd(net Network, history History)
+}
+
+// CallbackFuncs implements Callback with optional functions.
+type CallbackFuncs struct {
+	BatchEnd func(net Network, results TrainingResults)
+	EpochEnd func(net Network, results EpochResults) bool
+	TrainEnd func(net Network, history History)
+}
+
+func (c CallbackFuncs) OnBatchEnd(net Network, results TrainingResults) {
+	if c.BatchEnd != nil {
+		c.BatchEnd(net, results)
+	}
+}
+
+func (c CallbackFuncs) OnEpochEnd(net Network, results EpochResults) bool {
+	if c.EpochEnd != nil {
+		return c.EpochEnd(net, results)
+	}
+	return false
+}
+
+func (c CallbackFuncs) OnTrainEnd(net Network, history History) {
+	if c.TrainEnd != nil {
+		c.TrainEnd(net, history)
+	}
+}
+
+// checkMetrics returns an error if a callback monitors a validation metric
+// but there is no validation set.
+func (t *trainer) checkMetrics(val Dataset) error {
+	if val != nil && val.Len() > 0 {
+		return nil
+	}
+	for _, cb := range t.opts.Callbacks {
+		if m, ok := cb.(interface{ metric() Metric }); ok && m.metric() != LossMetric {
+			return fmt.Errorf("%s is monitored without a validation set", m.metric())
+		}
+	}
+	return nil
+}
+
+// batchEnd notifies the callbacks if the last iteration updated the
+// parameters, otherwise it keeps the results for flush.
+func (t *trainer) batchEnd(results TrainingResults) {
+	if t.pending != 0 {
+		t.last = results
+		return
+	}
+	for _, cb := range t.opts.Callbacks {
+		cb.OnBatchEnd(t.net, results)
+	}
+}
+
+// Metric selects a value of the epoch results to monitor.
+type Metric string
+
+// Available metrics
+const (
+	LossMetric        Metric = "loss"
+	ValLossMetric     Metric = "val_loss"
+	ValAccuracyMetric Metric = "val_accuracy"
+)
+
+func (m Metric) value(results EpochResults) float64 {
+	switch m {
+	case LossMetric:
+		return results.Loss
+	case ValLossMetric:
+		return results.ValLoss
+	case ValAccuracyMetric:
+		return results.ValAccuracy
+	}
+	panic(fmt.Errorf("unknown metric %q", m))
+}
+
+// improved returns true if value is better than best by more than minDelta.
+// Accuracy improves when it increases, losses when they decrease.
+func (m Metric) improved(value, best, minDelta float64) bool {
+	if m == ValAccuracyMetric {
+		return value > best+minDelta
+	}
+	return value < best-minDelta
+}
+
+// plateau tracks the epochs since a metric last improved.
+type plateau struct {
+	monitor  Metric
+	minDelta float64
+	best     float64
+	wait     int
+}
+
+func newPlateau(monitor Metric, minDelta float64) plateau {
+	p := plateau{monitor: monitor, minDelta: minDelta, best: math.Inf(1)}
+	if monitor == ValAccuracyMetric {
+		p.best = math.Inf(-1)
+	}
+	return p
+}
+
+// metric returns the monitored metric.
+func (p *plateau) metric() Metric {
+	return p.monitor
+}
+
+// update returns the number of epochs since the metric improved.
+func (p *plateau) update(results EpochResults) int {
+	if value := p.monitor.value(results); p.monitor.improved(value, p.best, p.minDelta) {
+		p.best = value
+		p.wait = 0
+	} else {
+		p.wait++
+	}
+	return p.wait
+}
+
+// Logger writes the results of every epoch to w.
+func Logger(w io.Writer) Callback {
+	return CallbackFuncs{
+		EpochEnd: func(net Network, r EpochResults) bool {
+			fmt.Fprintf(w, "epoch %d: loss=%.6f val_loss=%.6f val_accuracy=%.4f lr=%g (%v)\n",
+				r.Epoch, r.Loss, r.ValLoss, r.ValAccuracy, r.LearningRate, r.Duration)
+			return false
+		},
+	}
+}
+
+// EarlyStopping stops Fit once the monitored metric has not improved by more
+// than minDelta for patience epochs.
+func EarlyStopping(monitor Metric, patience int, minDelta float64) Callback {
+	return &earlyStopping{newPlateau(monitor, minDelta), patience}
+}
+
+type earlyStopping struct {
+	plateau
+	patience int
+}
+
+func (e *earlyStopping) OnBatchEnd(net Network, results TrainingResults) {}
+
+func (e *earlyStopping) OnEpochEnd(net Network, results EpochResults) bool {
+	return e.update(results) >= e.patience
+}
+
+func (e *earlyStopping) OnTrainEnd(net Network, history History) {}
+
+// MarshalBinary encodes the state of the callback for checkpoints.
+func (e *earlyStopping) MarshalBinary() ([]byte, error) {
+	return encodeState(e.best, e.wait)
+}
+
+// UnmarshalBinary restores the state of the callback from a checkpoint.
+func (e *earlyStopping) UnmarshalBinary(data []byte) error {
+	return decodeState(data, &e.best, &e.wait)
+}
+
+// RateScaler is implemented by callbacks which adjust the learning rate of
+// the trainer. The trainer passes the rate of its schedule through every
+// callback which implements it.
+type RateScaler interface {
+	ScaleRate(rate float64) float64
+}
+
+// ReduceLROnPlateau is a Callback which multiplies the learning rate of the
+// trainer by factor, down to minRate, whenever the monitored metric has not
+// improved for patience epochs. The reduction applies on top of the schedule
+// of the trainer.
+type ReduceLROnPlateau struct {
+	plateau
+	factor   float64
+	patience int
+	minRate  float64
+
+	// scale applied to the scheduled learning rate
+	scale float64
+}
+
+// NewReduceLROnPlateau creates a callback which reduces the learning rate
+// when the monitored metric stops improving.
+func NewReduceLROnPlateau(monitor Metric, factor float64, patience int, minRate float64) *ReduceLROnPlateau {
+	if factor <= 0 || factor >= 1 {
+		panic("learning rate reduction factor must be between 0 and 1")
+	}
+	return &ReduceLROnPlateau{newPlateau(monitor, 0), factor, patience, minRate, 1}
+}
+
+// ScaleRate returns the reduced learning rate. The reduction stops at minRate
+// but never raises a lower scheduled rate.
+func (r *ReduceLROnPlateau) ScaleRate(rate float64) float64 {
+	return math.Max(rate*r.scale, math.Min(rate, r.minRate))
+}
+
+func (r *ReduceLROnPlateau) OnBatchEnd(net Network, results TrainingResults) {}
+
+func (r *ReduceLROnPlateau) OnEpochEnd(net Network, results EpochResults) bool {
+	if r.update(results) >= r.patience {
+		r.scale *= r.factor
+		r.wait = 0
+	}
+	return false
+}
+
+func (r *ReduceLROnPlateau) OnTrainEnd(net Network, history History) {}
+
+// MarshalBinary encodes the state of the callback for checkpoints.
+func (r *ReduceLROnPlateau) MarshalBinary() ([]byte, error) {
+	return encodeState(r.best, r.wait, r.scale)
+}
+
+// UnmarshalBinary restores the state of the callback from a checkpoint.
+func (r *ReduceLROnPlateau) UnmarshalBinary(data []byte) error {
+	return decodeState(data, &r.best, &r.wait, &r.scale)
+}
@@ -0,0 +1,104 @@
+package reticulum
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestTrainer_FitCallbacks(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// batches of 2, and of 3 with an incomplete last batch, both update the
+	// parameters twice per epoch
+	for _, size := range []int{2, 3} {
+		var batches, ends int
+		counter := CallbackFuncs{
+			BatchEnd: func(net Network, results TrainingResults) { batches++ },
+			TrainEnd: func(net Network, history History) { ends++ },
+		}
+
+		// without updates the validation loss never improves
+		data := orData()
+		trainer := NewTrainer(net, WithLearningRate(0), WithBatchSize(size), WithCallbacks(counter, EarlyStopping(ValLossMetric, 3, 0)))
+		history, err := trainer.Fit(context.Background(), data, data, 100)
+		if err != nil {
+			t.Fatalf("Fit() error = %v", err)
+		}
+		if len(history) != 4 {
+			t.Errorf("batch size %d: len(history) = %v, want 4", size, len(history))
+		}
+		if batches != 8 || ends != 1 {
+			t.Errorf("batch size %d: got %v batch ends and %v train ends, want 8 and 1", size, batches, ends)
+		}
+	}
+}
+
+func TestReduceLROnPlateau(t *testing.T) {
+	s := NewReduceLROnPlateau(ValAccuracyMetric, 0.5, 2, 0.01)
+	for i, acc := range []float64{0.5, 0.6, 0.6, 0.6, 0.6, 0.6, 0.6, 0.6, 0.6} {
+		s.OnEpochEnd(nil, EpochResults{Epoch: i, ValAccuracy: acc})
+	}
+
+	// reduced after the 4th, 6th and 8th epoch and clamped to the minimum
+	if got := s.ScaleRate(0.1); got != 0.0125 {
+		t.Errorf("ScaleRate() = %v, want 0.0125", got)
+	}
+	if got := s.ScaleRate(0.05); got != 0.01 {
+		t.Errorf("ScaleRate() = %v, want 0.01", got)
+	}
+	if got := s.ScaleRate(0.001); got != 0.001 {
+		t.Errorf("ScaleRate() = %v, want 0.001", got)
+	}
+}
+
+func TestReduceLROnPlateau_Schedule(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// the loss never improves without updates, the rate is halved after
+	// every epoch on top of the decay of the schedule
+	data := orData()
+	plateau := NewReduceLROnPlateau(LossMetric, 0.5, 1, 0)
+	tr := NewTrainer(net, WithLearningRate(0), WithBatchSize(4), WithSchedule(StepDecay(4, 0.5)), WithCallbacks(plateau)).(*trainer)
+	if _, err := tr.Fit(context.Background(), data, nil, 3, WithoutShuffle()); err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+
+	// reduced twice after 12 iterations with the rate of the schedule at 0.125
+	tr.opts.LearningRate = 1
+	if got := tr.learningRate(); got != 0.125*0.25 {
+		t.Errorf("learningRate() = %v, want %v", got, 0.125*0.25)
+	}
+}
+
+func TestTrainer_FitValidationMetric(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	trainer := NewTrainer(net, WithCallbacks(EarlyStopping(ValLossMetric, 1, 0)))
+	if _, err := trainer.Fit(context.Background(), orData(), nil, 10); err == nil {
+		t.Errorf("Fit() without a validation set did not return an error")
+	}
+}
@@ -0,0 +1,235 @@
+package reticulum
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// checkpoint is the complete state of a trainer.
+type checkpoint struct {
+	K            int
+	LearningRate float64
+
+	// samples accumulated in the gradients since the last update
+	Pending int
+
+	// epochs completed by Fit and the epoch in progress
+	Epoch    int
+	Progress *epochProgress
+
+	// parameters and the gradients accumulated in the current batch
+	Weights   [][]float64
+	Gradients [][]float64
+
+	// encoded state of the optimizer, nil before the first update
+	Optimizer []byte
+
+	// encoded state of the schedule, nil for schedules without state
+	Schedule []byte
+
+	// encoded state of each callback, nil for callbacks without state
+	Callbacks [][]byte
+
+	// encoded state of the random source, nil without a seed
+	Rand []byte
+
+	// curvature history of full batch training
+	LBFGS []byte
+}
+
+// Checkpoint writes the complete state of the training to w: the parameters
+// and gradients of the network, the iteration counter, the progress of Fit,
+// the state of the optimizer, schedule and callbacks and the position of the
+// random source set with WithSeed. Restoring the checkpoint into a trainer
+// with the same network and options continues the training exactly where it
+// stopped, also in the middle of an epoch of Fit, for example after Fit
+// returns on a cancelled context.
+//
+// The optimizer must implement encoding.BinaryMarshaler. Schedules are
+// saved if they implement it, otherwise they must only depend on the
+// iteration counter. The same holds for the state of callbacks.
+func (t *trainer) Checkpoint(w io.Writer) error {
+	c := checkpoint{K: t.k, LearningRate: t.lr, Pending: t.pending, Epoch: t.epoch, Progress: t.progress}
+	for _, pg := range t.net.GetResponse() {
+		c.Weights = append(c.Weights, pg.Weights)
+		c.Gradients = append(c.Gradients, pg.Gradients)
+	}
+
+	var err error
+	if t.grads != nil {
+		m, ok := t.optimizer.(encoding.BinaryMarshaler)
+		if !ok {
+			return fmt.Errorf("optimizer %T does not implement encoding.BinaryMarshaler", t.optimizer)
+		} else if c.Optimizer, err = m.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	if m, ok := t.opts.Schedule.(encoding.BinaryMarshaler); ok {
+		if c.Schedule, err = m.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	for _, cb := range t.opts.Callbacks {
+		var state []byte
+		if m, ok := cb.(encoding.BinaryMarshaler); ok {
+			if state, err = m.MarshalBinary(); err != nil {
+				return err
+			}
+		}
+		c.Callbacks = append(c.Callbacks, state)
+	}
+	if t.opts.Source != nil {
+		if c.Rand, err = t.opts.Source.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	if t.lbfgs != nil {
+		if c.LBFGS, err = encodeState(t.lbfgs.s, t.lbfgs.y, t.lbfgs.rho); err != nil {
+			return err
+		}
+	}
+	return gob.NewEncoder(w).Encode(c)
+}
+
+// Restore reads a checkpoint written by Checkpoint and replaces the state of
+// the training with it. The trainer is left unchanged if the checkpoint does
+// not match it.
+func (t *trainer) Restore(r io.Reader) error {
+	var c checkpoint
+	if err := gob.NewDecoder(r).Decode(&c); err != nil {
+		return err
+	}
+
+	// validate the checkpoint before changing the trainer
+	resp := t.net.GetResponse()
+	if len(c.Weights) != len(resp) || len(c.Gradients) != len(resp) {
+		return fmt.Errorf("checkpoint has %d sets of parameters, network has %d", len(c.Weights), len(resp))
+	}
+	for i, pg := range resp {
+		if len(c.Weights[i]) != len(pg.Weights) || len(c.Gradients[i]) != len(pg.Gradients) {
+			return fmt.Errorf("checkpoint parameters %d have size %d, network has %d", i, len(c.Weights[i]), len(pg.Weights))
+		}
+	}
+	if len(c.Callbacks) != len(t.opts.Callbacks) {
+		return fmt.Errorf("checkpoint has %d callbacks, trainer has %d", len(c.Callbacks), len(t.opts.Callbacks))
+	}
+
+	var targets []encoding.BinaryUnmarshaler
+	var states [][]byte
+	if c.Optimizer != nil {
+		u, ok := t.optimizer.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return fmt.Errorf("optimizer %T does not implement encoding.BinaryUnmarshaler", t.optimizer)
+		}
+		targets, states = append(targets, u), append(states, c.Optimizer)
+	}
+	if c.Schedule != nil {
+		u, ok := t.opts.Schedule.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return fmt.Errorf("schedule %T does not implement encoding.BinaryUnmarshaler", t.opts.Schedule)
+		}
+		targets, states = append(targets, u), append(states, c.Schedule)
+	}
+	for i, state := range c.Callbacks {
+		if len(state) == 0 {
+			continue
+		}
+		u, ok := t.opts.Callbacks[i].(encoding.BinaryUnmarshaler)
+		if !ok {
+			return fmt.Errorf("callback %T does not implement encoding.BinaryUnmarshaler", t.opts.Callbacks[i])
+		}
+		targets, states = append(targets, u), append(states, state)
+	}
+
+	// decode into temporary values
+	var source *RandSource
+	if c.Rand != nil {
+		if t.opts.Source == nil {
+			return fmt.Errorf("checkpoint has a random state but the trainer has no seed")
+		}
+		source = &RandSource{}
+		if err := source.UnmarshalBinary(c.Rand); err != nil {
+			return err
+		}
+	}
+	var curvature *lbfgs
+	if c.LBFGS != nil {
+		curvature = &lbfgs{}
+		if err := decodeState(c.LBFGS, &curvature.s, &curvature.y, &curvature.rho); err != nil {
+			return err
+		}
+	}
+	if err := unmarshalStates(targets, states); err != nil {
+		return err
+	}
+
+	// commit
+	t.grads = nil
+	if c.Optimizer != nil {
+		t.grads = accumulators(resp)
+	}
+	if source != nil {
+		*t.opts.Source = *source
+	}
+	t.lbfgs = curvature
+	for i, pg := range resp {
+		copy(pg.Weights, c.Weights[i])
+		copy(pg.Gradients, c.Gradients[i])
+	}
+	t.k, t.lr, t.pending = c.K, c.LearningRate, c.Pending
+	t.epoch, t.progress = c.Epoch, c.Progress
+	return nil
+}
+
+// unmarshalStates decodes each state into its target. The optimizer,
+// schedule and callbacks decode their state in place, so if one fails the
+// targets are rolled back to the state they had before.
+func unmarshalStates(targets []encoding.BinaryUnmarshaler, states [][]byte) error {
+	prev := make([][]byte, len(targets))
+	for i, u := range targets {
+		if m, ok := u.(encoding.BinaryMarshaler); ok {
+			var err error
+			if prev[i], err = m.MarshalBinary(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, u := range targets {
+		if err := u.UnmarshalBinary(states[i]); err != nil {
+			for j := i; j >= 0; j-- {
+				if prev[j] != nil {
+					targets[j].UnmarshalBinary(prev[j])
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeState encodes the values with gob.
+func encodeState(values ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeState decodes values encoded by encodeState into the pointers.
+func decodeState(data []byte, values ...interface{}) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	for _, v := range values {
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package reticulum
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestTrainer_Checkpoint(t *testing.T) {
+	newTrainer := func() Trainer {
+		net, err := NewNetwork([]layers.LayerDef{
+			{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+			{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+			{Type: layers.Dropout, LayerConfig: &layers.DropoutLayerConfig{DropoutProbability: 0.2}},
+			{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+		})
+		if err != nil {
+			t.Fatalf("NewNetwork() error = %v", err)
+		}
+		plateau := NewReduceLROnPlateau(LossMetric, 0.5, 1, 0)
+		return NewTrainer(net, WithMethod(Adam), WithBatchSize(5), WithSeed(7), WithCallbacks(plateau))
+	}
+
+	data := orData()
+	weights := func(tr Trainer) []float64 {
+		return flattenParams(tr.(*trainer).net.GetResponse())
+	}
+
+	// train, checkpoint mid-batch and continue
+	a := newTrainer()
+	a.Fit(context.Background(), data, nil, 3)
+	var buf bytes.Buffer
+	if err := a.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+	want, _ := a.Fit(context.Background(), data, nil, 3)
+
+	// resume from the checkpoint in a new trainer
+	b := newTrainer()
+	if err := b.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	got, _ := b.Fit(context.Background(), data, nil, 3)
+
+	for i := range want {
+		if got[i].Loss != want[i].Loss || got[i].LearningRate != want[i].LearningRate {
+			t.Errorf("epoch %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	wa, wb := weights(a), weights(b)
+	for i := range wa {
+		if wa[i] != wb[i] {
+			t.Fatalf("weight %d = %v, want %v", i, wb[i], wa[i])
+		}
+	}
+}
+
+func TestTrainer_CheckpointMidEpoch(t *testing.T) {
+	var inputs []*volume.Volume
+	var targets []Target
+	for i := 0; i < 10; i++ {
+		x, y := float64(i%4)/3, float64(i%3)/2
+		inputs = append(inputs, volume.NewVolume(volume.NewDimensions(1, 1, 2), volume.WithWeights([]float64{x, y})))
+		targets = append(targets, Target{Label: i % 2})
+	}
+	data := NewDataset(inputs, targets)
+
+	// the callback cancels Fit after the first batch of the second epoch
+	newTrainer := func(cancel func()) Trainer {
+		net, err := NewNetwork([]layers.LayerDef{
+			{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+			{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+			{Type: layers.Dropout, LayerConfig: &layers.DropoutLayerConfig{DropoutProbability: 0.2}},
+			{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+		})
+		if err != nil {
+			t.Fatalf("NewNetwork() error = %v", err)
+		}
+		seedWeights(net, 1)
+
+		var batches int
+		stop := CallbackFuncs{BatchEnd: func(net Network, results TrainingResults) {
+			if batches++; batches == 3 && cancel != nil {
+				cancel()
+			}
+		}}
+		plateau := NewReduceLROnPlateau(LossMetric, 0.5, 1, 0)
+		return NewTrainer(net, WithMethod(Adam), WithBatchSize(4), WithSeed(7),
+			WithCallbacks(stop, plateau, EarlyStopping(LossMetric, 2, 0)))
+	}
+
+	ref := newTrainer(nil)
+	want, err := ref.Fit(context.Background(), data, nil, 3)
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+
+	// interrupt, checkpoint and resume in a new trainer
+	ctx, cancel := context.WithCancel(context.Background())
+	a := newTrainer(cancel)
+	if history, err := a.Fit(ctx, data, nil, 3); err != context.Canceled || len(history) != 1 {
+		t.Fatalf("Fit() = %d epochs with error %v, want 1 and %v", len(history), err, context.Canceled)
+	}
+	var buf bytes.Buffer
+	if err := a.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+
+	b := newTrainer(nil)
+	if err := b.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	got, err := b.Fit(context.Background(), data, nil, 2)
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	for i := range got {
+		w := want[i+1]
+		if got[i].Epoch != w.Epoch || got[i].Loss != w.Loss || got[i].LearningRate != w.LearningRate {
+			t.Errorf("epoch %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+
+	wr, wb := flattenParams(ref.(*trainer).net.GetResponse()), flattenParams(b.(*trainer).net.GetResponse())
+	for i := range wr {
+		if wr[i] != wb[i] {
+			t.Fatalf("weight %d = %v, want %v", i, wb[i], wr[i])
+		}
+	}
+}
+
+func TestTrainer_RestoreMismatch(t *testing.T) {
+	newTrainer := func(opts ...OptionFunc) Trainer {
+		net, err := NewNetwork([]layers.LayerDef{
+			{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+			{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+			{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+		})
+		if err != nil {
+			t.Fatalf("NewNetwork() error = %v", err)
+		}
+		tr := NewTrainer(net, append([]OptionFunc{WithMethod(Adam), WithBatchSize(2)}, opts...)...)
+		if _, err := tr.Fit(context.Background(), orData(), nil, 2); err != nil {
+			t.Fatalf("Fit() error = %v", err)
+		}
+		return tr
+	}
+	save := func(tr Trainer) []byte {
+		var buf bytes.Buffer
+		if err := tr.Checkpoint(&buf); err != nil {
+			t.Fatalf("Checkpoint() error = %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// checkpoints with more callbacks, a random state and no gradients
+	truncated := save(newTrainer())
+	var c checkpoint
+	gob.NewDecoder(bytes.NewReader(truncated)).Decode(&c)
+	c.Gradients = nil
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(c)
+
+	mismatched := map[string][]byte{
+		"callbacks": save(newTrainer(WithCallbacks(NewReduceLROnPlateau(LossMetric, 0.5, 1, 0)))),
+		"seed":      save(newTrainer(WithSeed(3))),
+		"gradients": buf.Bytes(),
+	}
+	for name, data := range mismatched {
+		tr := newTrainer()
+		before := save(tr)
+		if err := tr.Restore(bytes.NewReader(data)); err == nil {
+			t.Errorf("Restore() of a checkpoint with other %s succeeded, want error", name)
+		} else if after := save(tr); !bytes.Equal(after, before) {
+			t.Errorf("Restore() of a checkpoint with other %s changed the trainer", name)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package reticulum
+
+import (
+	"context"
+	"io"
+	"math/rand"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// Dataset is a collection of samples which can be accessed by index.
+type Dataset interface {
+	Len() int
+	Get(i int) (*volume.Volume, Target)
+}
+
+// Sample is a single input with its target. Samples for networks with
+// several inputs set Inputs, keyed by the name of each input, instead of
+// Input.
+type Sample struct {
+	Input  *volume.Volume
+	Inputs map[string]*volume.Volume
+	Target Target
+}
+
+// forward runs the input of the sample through the network.
+func (s Sample) forward(net Network, training bool) error {
+	if s.Inputs == nil {
+		net.Forward(s.Input, training)
+		return nil
+	}
+	_, err := net.ForwardInputs(s.Inputs, training)
+	return err
+}
+
+// clone returns the sample with copies of its input volumes.
+func (s Sample) clone() Sample {
+	if s.Inputs == nil {
+		s.Input = s.Input.Clone()
+		return s
+	}
+
+	inputs := make(map[string]*volume.Volume, len(s.Inputs))
+	for name, vol := range s.Inputs {
+		inputs[name] = vol.Clone()
+	}
+	s.Inputs = inputs
+	return s
+}
+
+// NewDataset returns a data set of the inputs and their targets.
+func NewDataset(inputs []*volume.Volume, targets []Target) Dataset {
+	if len(inputs) != len(targets) {
+		panic("data set requires a target for every input")
+	}
+	return &sliceDataset{inputs, targets}
+}
+
+type sliceDataset struct {
+	inputs  []*volume.Volume
+	targets []Target
+}
+
+func (d *sliceDataset) Len() int {
+	return len(d.inputs)
+}
+
+func (d *sliceDataset) Get(i int) (*volume.Volume, Target) {
+	return d.inputs[i], d.targets[i]
+}
+
+// Shuffle returns a view of the data set with the samples in a random order.
+func Shuffle(data Dataset, r *rand.Rand) Dataset {
+	return &shuffledDataset{data, r.Perm(data.Len())}
+}
+
+type shuffledDataset struct {
+	data  Dataset
+	order []int
+}
+
+func (d *shuffledDataset) Len() int {
+	return len(d.order)
+}
+
+func (d *shuffledDataset) Get(i int) (*volume.Volume, Target) {
+	return d.data.Get(d.order[i])
+}
+
+// Iterator streams samples which may not fit in memory.
+type Iterator interface {
+	// Next advances to the next sample. It returns false when the stream
+	// ends or fails.
+	Next() bool
+
+	// Sample returns the current sample.
+	Sample() Sample
+
+	// Err returns the error which ended the stream, if any.
+	Err() error
+}
+
+// Iterate returns an iterator over the samples of the data set in order.
+func Iterate(data Dataset) Iterator {
+	i := 0
+	return NewIterator(func() (Sample, error) {
+		if i >= data.Len() {
+			return Sample{}, io.EOF
+		}
+		vol, target := data.Get(i)
+		i++
+		return Sample{Input: vol, Target: target}, nil
+	})
+}
+
+// NewIterator returns an iterator which reads each sample from next. The
+// stream ends when next returns io.EOF, any other error is reported by Err.
+func NewIterator(next func() (Sample, error)) Iterator {
+	return &funcIterator{next: next}
+}
+
+type funcIterator struct {
+	next   func() (Sample, error)
+	sample Sample
+	err    error
+	done   bool
+}
+
+func (it *funcIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	sample, err := it.next()
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.done = true
+		return false
+	}
+	it.sample = sample
+	return true
+}
+
+func (it *funcIterator) Sample() Sample {
+	return it.sample
+}
+
+func (it *funcIterator) Err() error {
+	return it.err
+}
+
+// ShuffleBuffer shuffles a stream with a buffer of size samples. Each sample
+// is drawn at random from the buffer, which is refilled from the stream, so
+// larger buffers give more thorough shuffles.
+func ShuffleBuffer(it Iterator, size int, r *rand.Rand) Iterator {
+	if size <= 0 {
+		panic("shuffle buffer requires a size greater than 0")
+	}
+	buf := make([]Sample, 0, size)
+	return NewIterator(func() (Sample, error) {
+		for len(buf) < size && it.Next() {
+			buf = append(buf, it.Sample())
+		}
+		if len(buf) == 0 {
+			if err := it.Err(); err != nil {
+				return Sample{}, err
+			}
+			return Sample{}, io.EOF
+		}
+
+		i := r.Intn(len(buf))
+		sample := buf[i]
+		buf[i] = buf[len(buf)-1]
+		buf = buf[:len(buf)-1]
+		return sample, nil
+	})
+}
+
+// BatchIterator streams mini-batches of samples.
+type BatchIterator interface {
+	Next() bool
+	Batch() []Sample
+	Err() error
+}
+
+// Batches groups the samples of the stream into batches of size samples. The
+// last batch holds the remaining samples and may be smaller.
+func Batches(it Iterator, size int) BatchIterator {
+	if size <= 0 {
+		panic("batches require a size greater than 0")
+	}
+	return &batchIterator{it: it, size: size}
+}
+
+type batchIterator struct {
+	it    Iterator
+	size  int
+	batch []Sample
+}
+
+func (b *batchIterator) Next() bool {
+	b.batch = make([]Sample, 0, b.size)
+	for len(b.batch) < b.size && b.it.Next() {
+		b.batch = append(b.batch, b.it.Sample())
+	}
+	return len(b.batch) > 0
+}
+
+func (b *batchIterator) Batch() []Sample {
+	return b.batch
+}
+
+func (b *batchIterator) Err() error {
+	return b.it.Err()
+}
+
+// Prefetch reads up to size samples of the stream ahead in a goroutine, so
+// loading the data overlaps with training. The goroutine stops at the end of
+// the stream or when the context is done, whose error is then reported by Err.
+// A consumer which stops reading before either must call Close to stop the
+// goroutine. The underlying iterator must not be used after calling Prefetch.
+func Prefetch(ctx context.Context, it Iterator, size int) *Prefetcher {
+	p := &Prefetcher{ctx: ctx, samples: make(chan Sample, size), stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+		defer close(p.samples)
+		for it.Next() {
+			select {
+			case p.samples <- it.Sample():
+			case <-ctx.Done():
+				return
+			case <-p.stop:
+				return
+			}
+		}
+		p.err = it.Err()
+	}()
+	return p
+}
+
+// Prefetcher is the Iterator returned by Prefetch.
+type Prefetcher struct {
+	ctx     context.Context
+	samples chan Sample
+	sample  Sample
+	done    bool
+
+	// closed by Close to stop the goroutine, which closes stopped when it
+	// returns
+	stop    chan struct{}
+	stopped chan struct{}
+	closed  bool
+
+	// error of the underlying iterator, set before samples is closed
+	err error
+}
+
+func (p *Prefetcher) Next() bool {
+	if p.closed {
+		return false
+	}
+
+	select {
+	case sample, ok := <-p.samples:
+		if !ok {
+			p.done = true
+			return false
+		}
+		p.sample = sample
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+func (p *Prefetcher) Sample() Sample {
+	return p.sample
+}
+
+func (p *Prefetcher) Err() error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	} else if p.done {
+		return p.err
+	}
+	return nil
+}
+
+// Close stops reading the stream and waits for the goroutine to return. Next
+// returns false after Close.
+func (p *Prefetcher) Close() error {
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+	}
+	<-p.stopped
+	return nil
+}
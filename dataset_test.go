@@ -0,0 +1,102 @@
+package reticulum
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// countStream streams the labels 0 to n-1 and then fails with err, or ends if
+// err is nil.
+func countStream(n int, err error) Iterator {
+	i := 0
+	return NewIterator(func() (Sample, error) {
+		if i == n {
+			if err != nil {
+				return Sample{}, err
+			}
+			return Sample{}, io.EOF
+		}
+		i++
+		return Sample{Input: volume.NewVolume(volume.NewDimensions(1, 1, 1)), Target: Target{Label: i - 1}}, nil
+	})
+}
+
+// drain returns the labels of the stream.
+func drain(it Iterator) []int {
+	var labels []int
+	for it.Next() {
+		labels = append(labels, it.Sample().Target.Label)
+	}
+	return labels
+}
+
+func TestShuffleBuffer(t *testing.T) {
+	it := ShuffleBuffer(countStream(100, nil), 10, rand.New(rand.NewSource(1)))
+	labels := drain(it)
+	if len(labels) != 100 || it.Err() != nil {
+		t.Fatalf("ShuffleBuffer() = %d samples, %v, want 100 samples", len(labels), it.Err())
+	}
+
+	seen := make(map[int]bool)
+	inOrder := true
+	for i, l := range labels {
+		seen[l] = true
+		inOrder = inOrder && l == i
+	}
+	if len(seen) != 100 || inOrder {
+		t.Errorf("ShuffleBuffer() = %v, want a permutation of 0..99", labels)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	b := Batches(countStream(10, nil), 4)
+	var sizes []int
+	for b.Next() {
+		sizes = append(sizes, len(b.Batch()))
+	}
+	if len(sizes) != 3 || sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+		t.Errorf("Batches() sizes = %v, want [4 4 2]", sizes)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	it := Prefetch(context.Background(), countStream(50, nil), 8)
+	if labels := drain(it); len(labels) != 50 || labels[49] != 49 || it.Err() != nil {
+		t.Errorf("Prefetch() = %v, %v, want 0..49", labels, it.Err())
+	}
+
+	failure := errors.New("read failed")
+	it = Prefetch(context.Background(), countStream(5, failure), 2)
+	if labels := drain(it); len(labels) != 5 || it.Err() != failure {
+		t.Errorf("Prefetch() = %v, %v, want 5 samples and %v", labels, it.Err(), failure)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it = Prefetch(ctx, countStream(1000, nil), 2)
+	it.Next()
+	cancel()
+	drain(it)
+	if it.Err() != context.Canceled {
+		t.Errorf("Prefetch() error = %v, want %v", it.Err(), context.Canceled)
+	}
+
+	// an endless stream is stopped by Close without cancelling the context
+	var reads int
+	p := Prefetch(context.Background(), NewIterator(func() (Sample, error) {
+		reads++
+		return Sample{}, nil
+	}), 2)
+	p.Next()
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	stopped := reads
+	if p.Next() || p.Err() != nil || reads != stopped {
+		t.Errorf("Prefetch() continued after Close, %d reads after %d", reads, stopped)
+	}
+}
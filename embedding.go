@@ -0,0 +1,99 @@
+package reticulum
+
+import (
+	"time"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+// EmbeddingLossFunc computes a loss over the embeddings produced by the
+// network for a tuple of inputs. It must write the gradient of the loss into
+// each embedding volume.
+type EmbeddingLossFunc func(embeddings []*volume.Volume) float64
+
+// ContrastiveLossFunc trains a network on pairs of inputs, which are either
+// similar or at least margin apart.
+func ContrastiveLossFunc(similar bool, margin float64) EmbeddingLossFunc {
+	return func(embeddings []*volume.Volume) float64 {
+		if len(embeddings) != 2 {
+			panic("contrastive loss expects a pair of inputs")
+		}
+		return layers.ContrastiveLoss(embeddings[0], embeddings[1], similar, margin)
+	}
+}
+
+// TripletLossFunc trains a network on (anchor, positive, negative) triplets
+// of inputs.
+func TripletLossFunc(margin float64) EmbeddingLossFunc {
+	return func(embeddings []*volume.Volume) float64 {
+		if len(embeddings) != 3 {
+			panic("triplet loss expects an anchor, positive and negative input")
+		}
+		return layers.TripletLoss(embeddings[0], embeddings[1], embeddings[2], margin)
+	}
+}
+
+// TrainEmbedding runs the network on every input, computes the loss over the
+// resulting embeddings and accumulates the gradients of every input into the
+// shared parameters. The network must end without a loss layer. Since the
+// layers only keep the activations of the last input, each input is forwarded
+// once through its own clone of the network, which keeps its activations and
+// dropout mask for the backward pass.
+func (t *trainer) TrainEmbedding(vols []*volume.Volume, lossFunc EmbeddingLossFunc) TrainingResults {
+	start := time.Now()
+	nets := t.embeddingNets(len(vols))
+	embeddings := make([]*volume.Volume, len(vols))
+	for i, vol := range vols {
+		embeddings[i] = nets[i].Forward(vol, true)
+		embeddings[i].ZeroGrad()
+	}
+	fwdTime := time.Now().Sub(start)
+
+	start = time.Now()
+	costLoss := lossFunc(embeddings)
+	resp := t.net.GetResponse()
+	for _, net := range nets {
+		net.BackwardOutput()
+
+		// sum the gradients of the clone into the network
+		for i, pg := range net.GetResponse() {
+			g := resp[i].Gradients
+			for j := range pg.Gradients {
+				g[j] += pg.Gradients[j]
+				pg.Gradients[j] = 0
+			}
+		}
+	}
+	bwdTime := time.Now().Sub(start)
+
+	l1DecayLoss, l2DecayLoss := t.step()
+	results := TrainingResults{
+		ForwardTime:  fwdTime,
+		BackwardTime: bwdTime,
+		L1DecayLoss:  l1DecayLoss,
+		L2DecayLoss:  l2DecayLoss,
+		CostLost:     costLoss,
+		TotalLoss:    costLoss + l1DecayLoss + l2DecayLoss,
+		LearningRate: t.lr,
+	}
+	t.batchEnd(results)
+	return results
+}
+
+// embeddingNets returns n clones of the network, one for each input of a
+// tuple. Dropout in the clones draws from the seeded source of the trainer.
+func (t *trainer) embeddingNets(n int) []Network {
+	for len(t.embedders) < n {
+		net := t.net.Clone()
+		if t.rand != nil {
+			for _, layer := range net.Layers() {
+				if r, ok := layer.(layers.RandomLayer); ok {
+					r.SetRand(t.rand)
+				}
+			}
+		}
+		t.embedders = append(t.embedders, net)
+	}
+	return t.embedders[:n]
+}
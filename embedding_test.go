@@ -0,0 +1,64 @@
+package reticulum
+
+import (
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestTrainer_TrainEmbedding(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(6), Dropout: &layers.DropoutLayerConfig{DropoutProbability: 0.5}},
+		{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+	seedWeights(net, 1)
+
+	vols := []*volume.Volume{
+		volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8})),
+		volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{-0.2, 0.9, 0.1})),
+		volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.4, 0.4, -0.6})),
+	}
+
+	// a trainer with the same seed draws the same dropout masks, and with a
+	// batch of two the parameters keep their gradients after one tuple
+	loss := func() float64 {
+		for _, pg := range net.GetResponse() {
+			for j := range pg.Gradients {
+				pg.Gradients[j] = 0
+			}
+		}
+		return NewTrainer(net, WithBatchSize(2), WithSeed(3)).TrainEmbedding(vols, TripletLossFunc(1.0)).CostLost
+	}
+	if loss() == 0 {
+		t.Fatal("TrainEmbedding() loss = 0, want a positive triplet loss")
+	}
+
+	resp := net.GetResponse()
+	var grads [][]float64
+	for _, pg := range resp {
+		grads = append(grads, append([]float64(nil), pg.Gradients...))
+	}
+
+	const h = 1e-6
+	for i, pg := range resp {
+		for j := range pg.Weights {
+			want := pg.Weights[j]
+			pg.Weights[j] = want + h
+			lp := loss()
+			pg.Weights[j] = want - h
+			lm := loss()
+			pg.Weights[j] = want
+
+			numeric := (lp - lm) / (2 * h)
+			if math.Abs(numeric-grads[i][j]) > 1e-5 {
+				t.Fatalf("gradient = %v, want %v", grads[i][j], numeric)
+			}
+		}
+	}
+}
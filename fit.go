@@ -0,0 +1,315 @@
+package reticulum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/eliquious/reticulum/layers"
+)
+
+// FitOptions configure the training loop of Fit.
+type FitOptions struct {
+	// Shuffle visits the training samples in a new random order each epoch
+	Shuffle bool
+
+	// Rand is the source of the shuffles. It defaults to the seeded source
+	// of the trainer set with WithSeed. Without a seed the shuffles are
+	// seeded from the current time and differ between runs.
+	Rand *rand.Rand
+
+	// Loss creates the loss function of each training sample from its target
+	Loss func(Target) LossFunc
+
+	// MiniBatches trains every batch with TrainMiniBatch
+	MiniBatches bool
+}
+
+type FitOptionFunc func(*FitOptions)
+
+// WithoutShuffle visits the training samples in order.
+func WithoutShuffle() FitOptionFunc {
+	return func(opts *FitOptions) {
+		opts.Shuffle = false
+	}
+}
+
+// WithRand shuffles the training samples with r. Use it or WithSeed for
+// reproducible shuffles.
+func WithRand(r *rand.Rand) FitOptionFunc {
+	return func(opts *FitOptions) {
+		opts.Rand = r
+	}
+}
+
+// WithTargetLoss trains each sample with the loss function created by fn. By
+// default samples are trained with TargetLossFunc.
+func WithTargetLoss(fn func(Target) LossFunc) FitOptionFunc {
+	return func(opts *FitOptions) {
+		opts.Loss = fn
+	}
+}
+
+// WithMiniBatches trains every batch in one pass through the network with
+// TrainMiniBatch. The network must be a BatchNetwork, the samples are trained
+// on their targets and WithTargetLoss doesn't apply. A ParallelTrainer
+// ignores the option.
+func WithMiniBatches() FitOptionFunc {
+	return func(opts *FitOptions) {
+		opts.MiniBatches = true
+	}
+}
+
+// EpochResults summarize one epoch of Fit.
+type EpochResults struct {
+	Epoch    int
+	Duration time.Duration
+
+	// Loss is the mean cost loss of the training samples
+	Loss float64
+
+	// LearningRate is the learning rate of the last iteration
+	LearningRate float64
+
+	// ValLoss is the mean loss of the validation samples. ValAccuracy is the
+	// fraction of the validation samples with a label target which are
+	// classified correctly, it is 0 if there are none.
+	ValLoss     float64
+	ValAccuracy float64
+}
+
+// History contains the results of each epoch of Fit.
+type History []EpochResults
+
+// Fit trains the network for the given number of epochs and evaluates it on
+// the validation set, which may be nil, after each epoch. Callbacks may only
+// monitor validation metrics if there is a validation set. The parameters are
+// updated every BatchSize samples as with Train, and with the remaining
+// samples at the end of each epoch. Fit stops when the context is
+// done and returns the history of the completed epochs with the error of the
+// context, or early when a callback requests it.
+//
+// Epochs are numbered from the epochs completed by earlier calls. An epoch
+// which was interrupted, or restored from a checkpoint taken in its middle,
+// is resumed at its next sample and counts as the first of the epochs.
+func (t *trainer) Fit(ctx context.Context, train, val Dataset, epochs int, opts ...FitOptionFunc) (History, error) {
+	fitOpts := t.fitOptions(opts)
+	return t.fit(ctx, t.datasetStream(train, fitOpts), val, epochs, fitOpts, t.batchTrainer(fitOpts))
+}
+
+// FitStream is Fit for data which is streamed. The stream function is called
+// at the start of every epoch for a new iterator over the training samples.
+// The samples are trained in the order of the iterator, the shuffle options
+// don't apply. Samples with named inputs train networks with several inputs;
+// the validation set must then be nil. Fit stops at the first error of an
+// iterator or of the inputs of a sample. An interrupted epoch is resumed by
+// skipping the samples already trained, so the iterators must repeat the same
+// samples in the same order to resume exactly.
+func (t *trainer) FitStream(ctx context.Context, stream func() Iterator, val Dataset, epochs int, opts ...FitOptionFunc) (History, error) {
+	fitOpts := t.fitOptions(opts)
+	return t.fit(ctx, stream, val, epochs, fitOpts, t.batchTrainer(fitOpts))
+}
+
+// batchTrainer returns the function which trains the batches of Fit.
+func (t *trainer) batchTrainer(fitOpts *FitOptions) func([]Sample, func(Target) LossFunc) (float64, error) {
+	if fitOpts.MiniBatches {
+		return t.trainMiniBatch
+	}
+	return t.trainSamples
+}
+
+// datasetStream iterates over the data set in a new order every epoch if the
+// samples are shuffled. The order is kept with the progress of the epoch.
+func (t *trainer) datasetStream(data Dataset, fitOpts *FitOptions) func() Iterator {
+	return func() Iterator {
+		if !fitOpts.Shuffle {
+			return Iterate(data)
+		}
+		if t.progress.Order == nil {
+			t.progress.Order = fitOpts.Rand.Perm(data.Len())
+		}
+		return Iterate(&shuffledDataset{data, t.progress.Order})
+	}
+}
+
+// trainSamples trains each sample of the batch in turn and returns the sum of
+// their losses.
+func (t *trainer) trainSamples(batch []Sample, loss func(Target) LossFunc) (float64, error) {
+	var cost float64
+	for _, sample := range batch {
+		if sample.Inputs == nil {
+			cost += t.Train(sample.Input, loss(sample.Target)).CostLost
+			continue
+		}
+
+		results, err := t.TrainInputs(sample.Inputs, loss(sample.Target))
+		if err != nil {
+			return cost, err
+		}
+		cost += results.CostLost
+	}
+	return cost, nil
+}
+
+// fitOptions applies the options. Samples are shuffled with the seeded source
+// of the trainer unless another source is given, or with a source seeded from
+// the current time if the trainer has no seed.
+func (t *trainer) fitOptions(opts []FitOptionFunc) *FitOptions {
+	fitOpts := &FitOptions{Shuffle: true, Loss: TargetLossFunc}
+	for _, optFn := range opts {
+		optFn(fitOpts)
+	}
+	if fitOpts.Rand == nil && t.rand != nil {
+		fitOpts.Rand = t.rand
+	} else if fitOpts.Rand == nil {
+		fitOpts.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return fitOpts
+}
+
+// fit runs the epochs, training each batch of the stream with train, which
+// returns the sum of the losses of the batch. Fit stops at the first error of
+// train.
+func (t *trainer) fit(ctx context.Context, stream func() Iterator, val Dataset, epochs int, fitOpts *FitOptions,
+	train func(batch []Sample, loss func(Target) LossFunc) (float64, error)) (history History, err error) {
+	if err := t.checkMetrics(val); err != nil {
+		return nil, err
+	}
+	history = History{}
+	defer func() {
+		for _, cb := range t.opts.Callbacks {
+			cb.OnTrainEnd(t.net, history)
+		}
+	}()
+
+	for i := 0; i < epochs; i++ {
+		start := time.Now()
+		if t.progress == nil {
+			t.progress = &epochProgress{Start: t.k}
+		}
+
+		// skip the samples trained before the epoch was interrupted
+		it := stream()
+		for skip := t.k - t.progress.Start; skip > 0 && it.Next(); skip-- {
+		}
+		for batches := Batches(it, t.opts.BatchSize); ; {
+			if err := ctx.Err(); err != nil {
+				return history, err
+			} else if !batches.Next() {
+				if err := batches.Err(); err != nil {
+					return history, err
+				}
+				break
+			}
+			cost, err := train(batches.Batch(), fitOpts.Loss)
+			if err != nil {
+				return history, err
+			}
+			t.progress.Loss += cost
+		}
+
+		// the last batch of the epoch may be incomplete
+		t.flush()
+
+		results := EpochResults{Epoch: t.epoch, LearningRate: t.lr}
+		if n := t.k - t.progress.Start; n > 0 {
+			results.Loss = t.progress.Loss / float64(n)
+		}
+		t.epoch++
+		t.progress = nil
+		if val != nil && val.Len() > 0 {
+			if results.ValLoss, results.ValAccuracy, err = Evaluate(t.net, val); err != nil {
+				return history, err
+			}
+		}
+		results.Duration = time.Now().Sub(start)
+		history = append(history, results)
+
+		var stop bool
+		for _, cb := range t.opts.Callbacks {
+			stop = cb.OnEpochEnd(t.net, results) || stop
+		}
+		if stop {
+			break
+		}
+	}
+	return history, nil
+}
+
+// epochProgress is the state of the epoch of Fit in progress.
+type epochProgress struct {
+	// iteration counter at the start of the epoch
+	Start int
+
+	// order of the shuffled samples, nil if they are not shuffled
+	Order []int
+
+	// sum of the losses of the samples trained
+	Loss float64
+}
+
+// Evaluate computes the mean loss of the first head of the network over the
+// data set, without touching the gradients of the parameters. The accuracy is
+// the fraction of the samples with a label target which are classified
+// correctly, it is 0 if there are none. Both are 0 for an empty data set. An
+// error is returned if the network has several inputs or the head of the
+// network is not a loss layer which accepts the targets.
+func Evaluate(net Network, data Dataset) (loss, accuracy float64, err error) {
+	if inputs := net.Inputs(); len(inputs) != 1 {
+		return 0, 0, fmt.Errorf("evaluation requires a network with a single input, network has %d", len(inputs))
+	}
+	head, err := headLayer(net)
+	if err != nil {
+		return 0, 0, err
+	} else if data.Len() == 0 {
+		return 0, 0, nil
+	}
+
+	var labeled, correct int
+	for i := 0; i < data.Len(); i++ {
+		vol, target := data.Get(i)
+		if !acceptsTarget(head, target) {
+			return 0, 0, fmt.Errorf("%s layer does not accept the target of sample %d", head.Type(), i)
+		}
+		out := net.Forward(vol, false)
+		loss += targetLoss(head, target)
+
+		if target.Values == nil {
+			labeled++
+			if argmax(out.Weights()) == target.Label {
+				correct++
+			}
+		}
+	}
+
+	if labeled > 0 {
+		accuracy = float64(correct) / float64(labeled)
+	}
+	return loss / float64(data.Len()), accuracy, nil
+}
+
+// headLayer returns the last layer of the first head of the network. It is
+// the last of the layers unless the network has a lastLayer method, as graph
+// networks do.
+func headLayer(net Network) (layers.Layer, error) {
+	if g, ok := net.(interface{ lastLayer() layers.Layer }); ok {
+		return g.lastLayer(), nil
+	}
+	l := net.Layers()
+	if len(l) == 0 {
+		return nil, errors.New("network has no layers")
+	}
+	return l[len(l)-1], nil
+}
+
+func argmax(w []float64) int {
+	best := 0
+	for i, v := range w {
+		if v > w[best] {
+			best = i
+		}
+	}
+	return best
+}
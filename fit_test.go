@@ -0,0 +1,130 @@
+package reticulum
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+// orData returns the logical or of two inputs with the class as the label.
+func orData() Dataset {
+	var inputs []*volume.Volume
+	var targets []Target
+	for _, s := range [][3]float64{{0, 0, 0}, {0, 1, 1}, {1, 0, 1}, {1, 1, 1}} {
+		inputs = append(inputs, volume.NewVolume(volume.NewDimensions(1, 1, 2), volume.WithWeights([]float64{s[0], s[1]})))
+		targets = append(targets, Target{Label: int(s[2])})
+	}
+	return NewDataset(inputs, targets)
+}
+
+func TestTrainer_Fit(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	seedWeights(net, 1)
+	data := orData()
+	trainer := NewTrainer(net, WithMethod(Adam), WithLearningRate(0.05))
+	history, err := trainer.Fit(context.Background(), data, data, 300, WithRand(rand.New(rand.NewSource(1))))
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	if len(history) != 300 {
+		t.Fatalf("len(history) = %v, want 300", len(history))
+	}
+	if last := history[len(history)-1]; last.ValAccuracy != 1 || last.ValLoss >= history[0].ValLoss {
+		t.Errorf("last epoch = %+v, want accuracy 1 and less loss than %v", last, history[0].ValLoss)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if history, err := trainer.Fit(ctx, data, nil, 10); err != context.Canceled || len(history) != 0 {
+		t.Errorf("Fit() = %v, %v, want no epochs and %v", history, err, context.Canceled)
+	}
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+		{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// the network ends without a loss layer
+	if _, _, err := Evaluate(net, orData()); err == nil {
+		t.Error("Evaluate() expected error for a network without a loss layer")
+	}
+
+	// a regression head cannot evaluate the labels of the validation set
+	net, err = NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(1)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 2), volume.WithWeights([]float64{1, 0}))
+	train := NewDataset([]*volume.Volume{x}, []Target{{Values: []float64{1}}})
+	if history, err := NewTrainer(net).Fit(context.Background(), train, orData(), 2); err == nil || len(history) != 0 {
+		t.Errorf("Fit() = %v, %v, want no epochs and an error", history, err)
+	}
+
+	// an empty data set has no loss, and other implementations of Network
+	// are evaluated on their last layer
+	if loss, _, err := Evaluate(net, NewDataset(nil, nil)); err != nil || loss != 0 {
+		t.Errorf("Evaluate() of an empty data set = %v, %v, want 0 and no error", loss, err)
+	}
+	if _, _, err := Evaluate(struct{ Network }{net}, train); err != nil {
+		t.Errorf("Evaluate() of a wrapped network error = %v", err)
+	}
+
+	// a network with several inputs
+	graph, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "a", Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)}},
+		{Def: layers.LayerDef{Name: "b", Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"a", "b"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+	if _, _, err := Evaluate(graph, orData()); err == nil {
+		t.Error("Evaluate() expected error for a network with several inputs")
+	}
+}
+
+func TestTrainer_FitPartialBatch(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// the fourth sample of each epoch is an incomplete batch of its own
+	trainer := NewTrainer(net, WithBatchSize(3))
+	if _, err := trainer.Fit(context.Background(), orData(), nil, 2, WithoutShuffle()); err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+	for _, pg := range net.GetResponse() {
+		for _, g := range pg.Gradients {
+			if g != 0 {
+				t.Fatalf("gradients = %v after Fit, want the last batch applied", pg.Gradients)
+			}
+		}
+	}
+}
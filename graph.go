@@ -0,0 +1,511 @@
+package reticulum
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	layers "github.com/eliquious/reticulum/layers"
+	volume "github.com/eliquious/reticulum/volume"
+)
+
+// GraphNode declares a node in a graph network. The node is built from Def,
+// including any activation or dropout layers it declares, and is fed by the
+// outputs of the nodes named in Inputs. Nodes are referenced by Def.Name.
+type GraphNode struct {
+	Def    layers.LayerDef
+	Inputs []string
+}
+
+// NewGraphNetwork creates a new network from a directed acyclic graph of nodes.
+// Merge nodes (Add, Multiply and Concat) accept several inputs, every other
+// node accepts exactly one. A node may feed any number of other nodes, in which
+// case the gradients from each of them are summed during the backward pass.
+// The graph may contain several input nodes, which are fed by ForwardInputs,
+// and several output nodes, or heads, which are trained by BackwardHeads. The
+// single output methods of the network use the first head that was declared.
+func NewGraphNetwork(nodes []GraphNode) (Network, error) {
+	if len(nodes) < 2 {
+		return nil, errors.New("at least one input and one output node are required")
+	}
+
+	// Index nodes by name
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		if node.Def.Name == "" {
+			return nil, fmt.Errorf("node %d must have a name", i)
+		} else if _, ok := index[node.Def.Name]; ok {
+			return nil, fmt.Errorf("duplicate node name: %s", node.Def.Name)
+		}
+		index[node.Def.Name] = i
+	}
+
+	// Validate edges
+	inputs := make([][]int, len(nodes))
+	for i, node := range nodes {
+		switch {
+		case node.Def.Type == layers.Input:
+			if len(node.Inputs) != 0 {
+				return nil, fmt.Errorf("input node %s cannot have inputs", node.Def.Name)
+			}
+		case isMergeType(node.Def.Type):
+			if len(node.Inputs) == 0 {
+				return nil, fmt.Errorf("merge node %s requires at least one input", node.Def.Name)
+			}
+		default:
+			if len(node.Inputs) != 1 {
+				return nil, fmt.Errorf("node %s requires exactly one input", node.Def.Name)
+			}
+		}
+
+		for _, name := range node.Inputs {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown input %s for node %s", name, node.Def.Name)
+			}
+			inputs[i] = append(inputs[i], j)
+		}
+	}
+
+	order, err := topologicalSort(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build nodes in dependency order so input dimensions are known
+	g := &graphNetwork{nodes: make([]*graphNode, len(nodes)), inputs: make(map[string]int)}
+	var allDefs []layers.LayerDef
+	var allLayers []layers.Layer
+	for _, i := range order {
+		def := nodes[i].Def
+		n := &graphNode{name: def.Name, inputs: inputs[i]}
+
+		for _, j := range n.inputs {
+			upstream := g.nodes[j]
+			n.slots = append(n.slots, upstream.consumers)
+			upstream.consumers++
+			def.Inputs = append(def.Inputs, upstream.output)
+		}
+		if len(def.Inputs) > 0 {
+			def.Input = def.Inputs[0]
+		}
+
+		// the first layer of the node, which may be an fc layer added in
+		// front of a loss layer, takes the input of the node
+		defs := layers.ActivateLayers([]layers.LayerDef{def})
+		defs[0].Input, defs[0].Inputs = def.Input, def.Inputs
+		for k := range defs {
+			if k > 0 {
+				defs[k].Input = defs[k-1].Output
+				defs[k].Inputs = nil
+			}
+
+			layer, err := newLayer(&defs[k])
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %v", def.Name, err)
+			}
+			n.layers = append(n.layers, layer)
+		}
+		allDefs = append(allDefs, defs...)
+		allLayers = append(allLayers, n.layers...)
+		n.output = defs[len(defs)-1].Output
+
+		if def.Type == layers.Input {
+			g.inputs[def.Name] = i
+		}
+		g.nodes[i] = n
+	}
+
+	for i, n := range g.nodes {
+		if n.consumers == 0 {
+			g.outputs = append(g.outputs, i)
+		}
+	}
+	if len(g.inputs) == 0 {
+		return nil, errors.New("graph network requires an input node")
+	} else if err := shareWeights(allDefs, allLayers); err != nil {
+		return nil, err
+	}
+
+	g.order = order
+	g.defs = allDefs
+	return g, nil
+}
+
+// isMergeType returns true if the layer type accepts several inputs.
+func isMergeType(t layers.LayerType) bool {
+	return t == layers.Add || t == layers.Multiply || t == layers.Concat
+}
+
+// topologicalSort orders the nodes so that every node comes after its inputs.
+// Ties are broken by declaration order.
+func topologicalSort(inputs [][]int) ([]int, error) {
+	pending := make([]int, len(inputs))
+	consumers := make([][]int, len(inputs))
+	for i, in := range inputs {
+		pending[i] = len(in)
+		for _, j := range in {
+			consumers[j] = append(consumers[j], i)
+		}
+	}
+
+	var order []int
+	var ready []int
+	for i := range inputs {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, c := range consumers[i] {
+			pending[c]--
+			if pending[c] == 0 {
+				ready = append(ready, c)
+			}
+		}
+	}
+
+	if len(order) != len(inputs) {
+		return nil, errors.New("graph network contains a cycle")
+	}
+	return order, nil
+}
+
+type graphNode struct {
+	name string
+
+	// upstream node indices and the slot each one reserved for this node
+	inputs []int
+	slots  []int
+
+	layers []layers.Layer
+	output volume.Dimensions
+
+	// number of nodes fed by this node
+	consumers int
+
+	outVol *volume.Volume
+
+	// input of the last layer, which receives the gradient of a loss layer
+	lastIn *volume.Volume
+
+	// per consumer copies of outVol, only used when the output fans out
+	edges []*volume.Volume
+}
+
+// edge returns the volume given to the consumer which reserved the slot.
+func (n *graphNode) edge(slot int) *volume.Volume {
+	if n.consumers > 1 {
+		return n.edges[slot]
+	}
+	return n.outVol
+}
+
+// forward runs the layers of the node and prepares a copy of its output for
+// every consumer so that each of them can write its own gradient.
+func (n *graphNode) forward(vols []*volume.Volume, training bool) *volume.Volume {
+	var out *volume.Volume
+	if merge, ok := n.layers[0].(layers.MergeLayer); ok {
+		out = merge.ForwardMerge(vols, training)
+	} else {
+		n.lastIn = vols[0]
+		out = n.layers[0].Forward(vols[0], training)
+	}
+	for k := 1; k < len(n.layers); k++ {
+		n.lastIn = out
+		out = n.layers[k].Forward(out, training)
+	}
+
+	n.outVol = out
+	if n.consumers > 1 {
+		n.edges = n.edges[:0]
+		for k := 0; k < n.consumers; k++ {
+			n.edges = append(n.edges, out.Clone())
+		}
+	}
+	return out
+}
+
+// backward sums the gradients of the consumers into the output volume and
+// propagates them through the layers of the node, starting with layer start.
+func (n *graphNode) backward(start int) {
+	if n.consumers > 1 {
+		n.outVol.ZeroGrad()
+		size := n.outVol.Size()
+		for _, e := range n.edges {
+			for i := 0; i < size; i++ {
+				n.outVol.AddGradByIndex(i, e.GetGradByIndex(i))
+			}
+		}
+	}
+
+	for k := start; k >= 0; k-- {
+		n.layers[k].Backward()
+	}
+}
+
+type graphNetwork struct {
+	nodes []*graphNode
+	order []int
+
+	// definitions of the layers in the order of Layers, used to share
+	// weights between clones
+	defs []layers.LayerDef
+
+	// input node indices by name
+	inputs map[string]int
+
+	// output node indices in declaration order
+	outputs []int
+
+	// unweighted losses of the heads from the last call to BackwardHeads
+	headLosses map[string]float64
+}
+
+func (g *graphNetwork) Size() int {
+	var size int
+	for _, n := range g.nodes {
+		size += len(n.layers)
+	}
+	return size
+}
+
+func (g *graphNetwork) Layers() []layers.Layer {
+	var l []layers.Layer
+	for _, i := range g.order {
+		l = append(l, g.nodes[i].layers...)
+	}
+	return l
+}
+
+func (g *graphNetwork) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	if len(g.inputs) != 1 {
+		panic("Forward requires a network with a single input, use ForwardInputs")
+	}
+	for _, i := range g.inputs {
+		return g.forward(map[int]*volume.Volume{i: vol}, training)
+	}
+	return nil
+}
+
+func (g *graphNetwork) ForwardInputs(inputs map[string]*volume.Volume, training bool) (*volume.Volume, error) {
+	vols := make(map[int]*volume.Volume, len(inputs))
+	for name, vol := range inputs {
+		i, ok := g.inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown input: %s", name)
+		} else if dim := g.nodes[i].output; vol.Dimensions() != dim {
+			return nil, fmt.Errorf("invalid dimensions for input %s: %v != %v", name, vol.Dimensions(), dim)
+		}
+		vols[i] = vol
+	}
+	for name := range g.inputs {
+		if _, ok := inputs[name]; !ok {
+			return nil, fmt.Errorf("missing input: %s", name)
+		}
+	}
+	return g.forward(vols, training), nil
+}
+
+// forward runs every node in dependency order. Input nodes are given the
+// volumes keyed by their node index.
+func (g *graphNetwork) forward(inputs map[int]*volume.Volume, training bool) *volume.Volume {
+	g.headLosses = nil
+	for _, i := range g.order {
+		n := g.nodes[i]
+		if vol, ok := inputs[i]; ok {
+			n.forward([]*volume.Volume{vol}, training)
+			continue
+		}
+
+		vols := make([]*volume.Volume, len(n.inputs))
+		for k, j := range n.inputs {
+			vols[k] = g.nodes[j].edge(n.slots[k])
+		}
+		n.forward(vols, training)
+	}
+	return g.nodes[g.outputs[0]].outVol
+}
+
+// lastLayer returns the final layer of the first output node.
+func (g *graphNetwork) lastLayer() layers.Layer {
+	out := g.nodes[g.outputs[0]]
+	return out.layers[len(out.layers)-1]
+}
+
+// propagate runs the backward pass from the given heads through the graph.
+// The loss layers at the end of the heads must already have written their
+// input gradients, unless fromOutput is set in which case the gradients of
+// the head outputs are propagated through every layer of the heads. Nodes
+// which do not feed any of the heads are skipped.
+func (g *graphNetwork) propagate(fromOutput bool, heads ...int) {
+	active := make([]bool, len(g.nodes))
+	for _, i := range heads {
+		active[i] = true
+	}
+
+	// clear the gradients of the copies given to skipped consumers
+	for _, n := range g.nodes {
+		for _, e := range n.edges {
+			e.ZeroGrad()
+		}
+	}
+
+	for k := len(g.order) - 1; k >= 0; k-- {
+		i := g.order[k]
+		if !active[i] {
+			continue
+		}
+
+		n := g.nodes[i]
+		if n.consumers == 0 && !fromOutput {
+			n.backward(len(n.layers) - 2)
+		} else {
+			n.backward(len(n.layers) - 1)
+		}
+		for _, j := range n.inputs {
+			active[j] = true
+		}
+	}
+}
+
+func (g *graphNetwork) Inputs() []string {
+	var names []string
+	for name := range g.inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *graphNetwork) Heads() []string {
+	var names []string
+	for _, i := range g.outputs {
+		names = append(names, g.nodes[i].name)
+	}
+	return names
+}
+
+func (g *graphNetwork) BackwardHeads(heads ...HeadLoss) float64 {
+	// resolve the heads before any gradient is written
+	var active []int
+	seen := make(map[string]bool, len(heads))
+	for _, h := range heads {
+		i := -1
+		for _, o := range g.outputs {
+			if g.nodes[o].name == h.Head {
+				i = o
+			}
+		}
+		if i < 0 {
+			panic(fmt.Errorf("unknown head: %s", h.Head))
+		} else if seen[h.Head] {
+			panic(fmt.Errorf("duplicate head: %s", h.Head))
+		}
+		seen[h.Head] = true
+		active = append(active, i)
+	}
+
+	var total float64
+	losses := make(map[string]float64, len(heads))
+	for k, h := range heads {
+		n := g.nodes[active[k]]
+		loss := headLoss(n.layers[len(n.layers)-1], n.lastIn, h)
+		losses[h.Head] = loss
+		total += h.Weight * loss
+	}
+
+	g.propagate(false, active...)
+	g.headLosses = losses
+	return total
+}
+
+func (g *graphNetwork) HeadLosses() map[string]float64 {
+	return g.headLosses
+}
+
+func (g *graphNetwork) Backward(index int) float64 {
+	lossLayer, ok := g.lastLayer().(layers.LossLayer)
+	if !ok {
+		panic("expecting loss layer as last layer in network")
+	}
+	loss := lossLayer.Loss(index)
+	g.propagate(false, g.outputs[0])
+	return loss
+}
+
+func (g *graphNetwork) GetCostLoss(vol *volume.Volume, index int) float64 {
+	g.Forward(vol, false)
+
+	lossLayer, ok := g.lastLayer().(layers.LossLayer)
+	if !ok {
+		panic("expecting loss layer as last layer in network")
+	}
+	return lossLayer.Loss(index)
+}
+
+func (g *graphNetwork) GetPrediction() int {
+	S := g.lastLayer()
+	if S.Type() != layers.SoftMax {
+		panic("GetPrediction assumes Softmax is the last layer in the network")
+	}
+	return layers.GetSoftMaxPrediction(S)
+}
+
+func (g *graphNetwork) Predict(vol *volume.Volume) (*Prediction, error) {
+	if len(g.inputs) != 1 {
+		return nil, errors.New("Predict requires a network with a single input")
+	}
+	out := g.Forward(vol, false)
+	return newPrediction(g.lastLayer(), out)
+}
+
+func (g *graphNetwork) GetResponse() []layers.LayerResponse {
+	resp := []layers.LayerResponse{}
+	for _, l := range g.Layers() {
+		resp = append(resp, l.GetResponse()...)
+	}
+	return resp
+}
+
+func (g *graphNetwork) MultiDimensionalLoss(y []float64) float64 {
+	lossLayer, ok := g.lastLayer().(layers.RegressionLossLayer)
+	if !ok {
+		panic("MultiDimensionalLoss assumes a Regression layer is the last layer in the network")
+	}
+	loss := lossLayer.MultiDimensionalLoss(y)
+	g.propagate(false, g.outputs[0])
+	return loss
+}
+
+func (g *graphNetwork) DimensionalLoss(index int, value float64) float64 {
+	lossLayer, ok := g.lastLayer().(layers.RegressionLossLayer)
+	if !ok {
+		panic("DimensionalLoss assumes a Regression layer is the last layer in the network")
+	}
+	loss := lossLayer.DimensionalLoss(index, value)
+	g.propagate(false, g.outputs[0])
+	return loss
+}
+
+func (g *graphNetwork) Output() *volume.Volume {
+	return g.nodes[g.outputs[0]].outVol
+}
+
+func (g *graphNetwork) BackwardOutput() {
+	g.propagate(true, g.outputs[0])
+}
+
+func (g *graphNetwork) Clone() Network {
+	clone := &graphNetwork{nodes: make([]*graphNode, len(g.nodes)), order: g.order, defs: g.defs, inputs: g.inputs, outputs: g.outputs}
+	clones := cloneLayers(g.defs, g.Layers())
+	for _, i := range g.order {
+		n := g.nodes[i]
+		clone.nodes[i] = &graphNode{name: n.name, inputs: n.inputs, slots: n.slots, layers: clones[:len(n.layers):len(n.layers)], output: n.output, consumers: n.consumers}
+		clones = clones[len(n.layers):]
+	}
+	return clone
+}
@@ -0,0 +1,268 @@
+package reticulum
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func residualGraph(t *testing.T, merge layers.LayerType) Network {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "a", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "b", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)}, Inputs: []string{"a"}},
+		{Def: layers.LayerDef{Name: "merge", Type: merge}, Inputs: []string{"a", "b"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"merge"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+	return net
+}
+
+func TestGraphNetwork_Gradients(t *testing.T) {
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	y := []float64{0.2, -0.4}
+
+	for _, merge := range []layers.LayerType{layers.Add, layers.Multiply, layers.Concat} {
+		t.Run(string(merge), func(t *testing.T) {
+			checkGradients(t, residualGraph(t, merge), x, y)
+		})
+	}
+}
+
+func TestGraphNetwork_LossHead(t *testing.T) {
+	net := residualGraph(t, layers.Add)
+
+	// the fc layer added in front of the regression head reads the merge node
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	y := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{-0.5, 0.3, 0.1}))
+	a := net.Forward(x, false).Clone()
+	b := net.Forward(y, false)
+	if a.GetByIndex(0) == b.GetByIndex(0) && a.GetByIndex(1) == b.GetByIndex(1) {
+		t.Errorf("Forward() = %v for both inputs", a.Weights())
+	}
+}
+
+func TestGraphNetwork_SplitConcat(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "a", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "lo", Type: layers.Split, LayerConfig: layers.NewSplitLayerConfig(layers.AxisZ, 0, 2)}, Inputs: []string{"a"}},
+		{Def: layers.LayerDef{Name: "hi", Type: layers.Split, LayerConfig: layers.NewSplitLayerConfig(layers.AxisZ, 1, 3)}, Inputs: []string{"a"}},
+		{Def: layers.LayerDef{Name: "hi2", Type: layers.Split, LayerConfig: layers.NewSplitLayerConfig(layers.AxisZ, 1, 2)}, Inputs: []string{"hi"}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat, LayerConfig: layers.NewConcatLayerConfig(layers.AxisX)}, Inputs: []string{"lo", "hi2", "lo"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	checkGradients(t, net, x, []float64{0.2, -0.4})
+}
+
+// checkGradients compares the analytic gradients of every parameter against
+// central differences of the regression loss.
+func checkGradients(t *testing.T, net Network, x *volume.Volume, y []float64) {
+	checkLossGradients(t, net, x, func() { net.MultiDimensionalLoss(y) }, func() float64 { return lossOnly(net, y) })
+}
+
+// checkLossGradients compares the gradients computed by backward against
+// central differences of loss, which must not modify the parameter gradients.
+func checkLossGradients(t *testing.T, net Network, x *volume.Volume, backward func(), loss func() float64) {
+	net.Forward(x, false)
+	backward()
+
+	const h = 1e-5
+	for _, resp := range net.GetResponse() {
+		for j := range resp.Weights {
+			want := resp.Weights[j]
+			resp.Weights[j] = want + h
+			net.Forward(x, false)
+			lp := loss()
+			resp.Weights[j] = want - h
+			net.Forward(x, false)
+			lm := loss()
+			resp.Weights[j] = want
+
+			numeric := (lp - lm) / (2 * h)
+			if math.Abs(numeric-resp.Gradients[j]) > 1e-6 {
+				t.Fatalf("gradient = %v, want %v", resp.Gradients[j], numeric)
+			}
+		}
+	}
+}
+
+// lossOnly computes the squared error of the last forward pass without
+// touching the parameter gradients.
+func lossOnly(net Network, y []float64) float64 {
+	l := net.Layers()
+	out := l[len(l)-1].(layers.RegressionLossLayer)
+	return out.MultiDimensionalLoss(y)
+}
+
+func TestNewGraphNetwork_Cycle(t *testing.T) {
+	_, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "a", Type: layers.Add}, Inputs: []string{"in", "b"}},
+		{Def: layers.LayerDef{Name: "b", Type: layers.Tanh}, Inputs: []string{"a"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"b"}},
+	})
+	if err == nil {
+		t.Errorf("NewGraphNetwork() expected error for cycle")
+	}
+}
+
+func TestGraphNetwork_ForwardInputs(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "image", Type: layers.Input, Output: volume.NewDimensions(2, 2, 1)}},
+		{Def: layers.LayerDef{Name: "meta", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "features", Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)}, Inputs: []string{"image"}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"features", "meta"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+
+	image := volume.NewVolume(volume.NewDimensions(2, 2, 1))
+	meta := volume.NewVolume(volume.NewDimensions(1, 1, 3))
+	if _, err := net.ForwardInputs(map[string]*volume.Volume{"image": image}, false); err == nil {
+		t.Errorf("ForwardInputs() expected error for missing input")
+	}
+	if _, err := net.ForwardInputs(map[string]*volume.Volume{"image": meta, "meta": meta}, false); err == nil {
+		t.Errorf("ForwardInputs() expected error for invalid dimensions")
+	}
+
+	out, err := net.ForwardInputs(map[string]*volume.Volume{"image": image, "meta": meta}, false)
+	if err != nil {
+		t.Fatalf("ForwardInputs() error = %v", err)
+	}
+	if got := out.Size(); got != 2 {
+		t.Errorf("ForwardInputs() output size = %v, want 2", got)
+	}
+}
+
+func TestGraphNetwork_BackwardHeads(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "trunk", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "cls", Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(3)}, Inputs: []string{"trunk"}},
+		{Def: layers.LayerDef{Name: "reg", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"trunk"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+	if got := net.Heads(); len(got) != 2 || got[0] != "cls" || got[1] != "reg" {
+		t.Fatalf("Heads() = %v, want [cls reg]", got)
+	}
+
+	heads := []HeadLoss{
+		{Head: "cls", Weight: 0.3, Target: Target{Label: 1}},
+		{Head: "reg", Weight: 2.0, Target: Target{Values: []float64{0.2, -0.4}}},
+	}
+	loss := func() float64 {
+		g := net.(*graphNetwork)
+		var total float64
+		for k, h := range heads {
+			n := g.nodes[g.outputs[k]]
+			total += h.Weight * targetLoss(n.layers[len(n.layers)-1], h.Target)
+		}
+		return total
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	checkLossGradients(t, net, x, func() { net.BackwardHeads(heads...) }, loss)
+
+	net.Forward(x, true)
+	net.BackwardHeads(heads...)
+	if got := net.HeadLosses(); len(got) != 2 {
+		t.Errorf("HeadLosses() = %v, want 2 losses", got)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("BackwardHeads() expected panic for a duplicate head")
+		}
+	}()
+	net.Forward(x, true)
+	net.BackwardHeads(heads[0], heads[1], heads[0])
+}
+
+func TestGraphNetwork_ShareWeights(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "left", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "right", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3), ShareWeightsWith: "enc"}, Inputs: []string{"left"}},
+		{Def: layers.LayerDef{Name: "enc", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"enc", "right"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+
+	// left (3 filters + bias), enc (3 filters + bias), out fc (2 filters + bias)
+	if got := len(net.GetResponse()); got != 11 {
+		t.Errorf("len(GetResponse()) = %v, want 11", got)
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	checkGradients(t, net, x, []float64{0.2, -0.4})
+}
+
+func TestTrainer_FitStreamInputs(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "a", Type: layers.Input, Output: volume.NewDimensions(1, 1, 1)}},
+		{Def: layers.LayerDef{Name: "b", Type: layers.Input, Output: volume.NewDimensions(1, 1, 1)}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"a", "b"}},
+		{Def: layers.LayerDef{Name: "hidden", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)}, Inputs: []string{"join"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(1)}, Inputs: []string{"hidden"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+	seedWeights(net, 1)
+
+	// learn the difference of the two inputs
+	var samples []Sample
+	for i := 0; i < 8; i++ {
+		a, b := float64(i%4)/4, float64(i/4)/2
+		samples = append(samples, Sample{
+			Inputs: map[string]*volume.Volume{
+				"a": volume.NewVolume(volume.NewDimensions(1, 1, 1), volume.WithWeights([]float64{a})),
+				"b": volume.NewVolume(volume.NewDimensions(1, 1, 1), volume.WithWeights([]float64{b})),
+			},
+			Target: Target{Values: []float64{a - b}},
+		})
+	}
+	stream := func() Iterator {
+		i := 0
+		return NewIterator(func() (Sample, error) {
+			if i >= len(samples) {
+				return Sample{}, io.EOF
+			}
+			i++
+			return samples[i-1], nil
+		})
+	}
+
+	trainer := NewTrainer(net, WithMethod(Adam), WithLearningRate(0.02))
+	history, err := trainer.FitStream(context.Background(), stream, nil, 200)
+	if err != nil {
+		t.Fatalf("FitStream() error = %v", err)
+	}
+	if first, last := history[0].Loss, history[len(history)-1].Loss; last > first/10 {
+		t.Errorf("loss = %v, want less than %v", last, first/10)
+	}
+
+	bad := map[string]*volume.Volume{"a": volume.NewVolume(volume.NewDimensions(1, 1, 2))}
+	if _, err := trainer.TrainInputs(bad, TargetLossFunc(Target{Values: []float64{0}})); err == nil {
+		t.Error("TrainInputs() expected error for invalid inputs")
+	}
+}
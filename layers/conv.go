@@ -138,7 +138,7 @@ func NewConvLayer(def LayerDef) Layer {
 	}
 
 	biases := volume.NewVolume(volume.NewDimensions(1, 1, outDepth), volume.WithInitialValue(bias))
-	return &convLayer{conf, def.Input, outDim, nil, nil, filters, biases}
+	return &convLayer{conf, def.Input, outDim, nil, nil, nil, nil, filters, biases, false}
 }
 
 type convLayer struct {
@@ -149,8 +149,14 @@ type convLayer struct {
 	inVol  *volume.Volume
 	outVol *volume.Volume
 
+	inBatch  *volume.Batch
+	outBatch *volume.Batch
+
 	filters []*volume.Volume
 	biases  *volume.Volume
+
+	// shared is set when the parameters belong to another layer
+	shared bool
 }
 
 func (*convLayer) Type() LayerType {
@@ -159,8 +165,13 @@ func (*convLayer) Type() LayerType {
 
 func (l *convLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 	l.inVol = vol
-	A := volume.NewVolume(l.output, volume.WithZeros())
+	l.outVol = volume.NewVolume(l.output, volume.WithZeros())
+	l.convolve(vol, l.outVol)
+	return l.outVol
+}
 
+// convolve writes the convolution of vol into A.
+func (l *convLayer) convolve(vol, A *volume.Volume) {
 	vDim := vol.Dimensions()
 	vsx, vsy, stride := vDim.X, vDim.Y, l.conf.Stride
 	for d := 0; d < l.output.Z; d++ {
@@ -192,15 +203,18 @@ func (l *convLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 			}
 		}
 	}
-
-	l.outVol = A
-	return l.outVol
 }
 
 func (l *convLayer) Backward() {
-	l.inVol.ZeroGrad()
+	l.backward(l.inVol, l.outVol)
+}
+
+// backward distributes the gradients of out to in, the input volume it was
+// convolved from, and accumulates the gradients of the filters.
+func (l *convLayer) backward(in, out *volume.Volume) {
+	in.ZeroGrad()
 
-	vDim := l.inVol.Dimensions()
+	vDim := in.Dimensions()
 	vsx, vsy, stride := vDim.X, vDim.Y, l.conf.Stride
 
 	for d := 0; d < l.output.Z; d++ {
@@ -213,7 +227,7 @@ func (l *convLayer) Backward() {
 			x := -l.conf.Padding
 			for ax := 0; ax < l.output.X; ax++ {
 				x += stride
-				chainGrad := l.outVol.GetGrad(ax, ay, d)
+				chainGrad := out.GetGrad(ax, ay, d)
 				for fy := 0; fy < fDim.Y; fy++ {
 					oy := y + fy
 					for fx := 0; fx < fDim.X; fx++ {
@@ -222,8 +236,8 @@ func (l *convLayer) Backward() {
 							for fz := 0; fz < fDim.Z; fz++ {
 								ix1 := ((vsy*oy)+ox)*vDim.Z + fz
 								ix2 := ((fDim.X*fy)+fx)*fDim.Z + fz
-								f.AddGradByIndex(ix2, l.inVol.GetByIndex(ix1)*chainGrad)
-								l.inVol.AddGradByIndex(ix1, f.GetByIndex(ix2)*chainGrad)
+								f.AddGradByIndex(ix2, in.GetByIndex(ix1)*chainGrad)
+								in.AddGradByIndex(ix1, f.GetByIndex(ix2)*chainGrad)
 							}
 						}
 					}
@@ -234,7 +248,27 @@ func (l *convLayer) Backward() {
 	}
 }
 
+// ForwardBatch convolves every sample of the batch into a single output batch.
+func (l *convLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	l.inBatch = b
+	l.outBatch = volume.NewBatch(b.N(), l.output)
+	for s := 0; s < b.N(); s++ {
+		l.convolve(b.At(s), l.outBatch.At(s))
+	}
+	return l.outBatch
+}
+
+func (l *convLayer) BackwardBatch() {
+	for s := 0; s < l.inBatch.N(); s++ {
+		l.backward(l.inBatch.At(s), l.outBatch.At(s))
+	}
+}
+
 func (l *convLayer) GetResponse() []LayerResponse {
+	if l.shared {
+		return []LayerResponse{}
+	}
+
 	var resp []LayerResponse
 	for i := 0; i < l.output.Z; i++ {
 		resp = append(resp, LayerResponse{
@@ -252,3 +286,18 @@ func (l *convLayer) GetResponse() []LayerResponse {
 	})
 	return resp
 }
+
+// Clone returns a copy whose parameters share the weights of the layer. The
+// parameters of a layer which shares the weights of another layer must be
+// linked again with ShareWeights.
+func (l *convLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	c.inBatch, c.outBatch = nil, nil
+	c.filters = make([]*volume.Volume, len(l.filters))
+	for i, f := range l.filters {
+		c.filters[i] = f.CloneShared()
+	}
+	c.biases = l.biases.CloneShared()
+	return &c
+}
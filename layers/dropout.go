@@ -20,7 +20,7 @@ func NewDropoutLayer(def LayerDef) Layer {
 	}
 
 	n := def.Output.Size()
-	return &dropoutLayer{conf, def.Input, def.Output, make([]bool, n, n), nil, nil}
+	return &dropoutLayer{conf, def.Input, def.Output, make([]bool, n, n), nil, nil, nil}
 }
 
 // DropoutLayerConfig contains the dropout probablity.
@@ -37,6 +37,9 @@ type dropoutLayer struct {
 
 	inVol  *volume.Volume
 	outVol *volume.Volume
+
+	// source of the dropouts, the global source if nil
+	rand *rand.Rand
 }
 
 func (l *dropoutLayer) Type() LayerType {
@@ -49,9 +52,14 @@ func (l *dropoutLayer) Forward(vol *volume.Volume, training bool) *volume.Volume
 	n := vol.Size()
 
 	if training {
+		random := rand.Float64
+		if l.rand != nil {
+			random = l.rand.Float64
+		}
+
 		// Perform dropout based on probabilty
 		for i := 0; i < n; i++ {
-			if rand.Float64() < l.config.DropoutProbability {
+			if random() < l.config.DropoutProbability {
 				vol2.SetByIndex(i, 0.0)
 				l.dropped[i] = true
 			} else {
@@ -86,6 +94,31 @@ func (l *dropoutLayer) Backward() {
 	}
 }
 
+// ForwardBatch drops the inputs of every sample of the batch in turn.
+func (l *dropoutLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	if len(l.dropped) < len(b.Weights()) {
+		l.dropped = make([]bool, len(b.Weights()))
+	}
+	return l.Forward(b.Flat(), training).AsBatch(b.N(), b.Dimensions())
+}
+
+func (l *dropoutLayer) BackwardBatch() {
+	l.Backward()
+}
+
+func (l *dropoutLayer) SetRand(r *rand.Rand) {
+	l.rand = r
+}
+
 func (l *dropoutLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+// Clone returns a copy which draws from the global source until SetRand is
+// called, as a *rand.Rand cannot be shared between goroutines.
+func (l *dropoutLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol, c.rand = nil, nil, nil
+	c.dropped = make([]bool, len(l.dropped))
+	return &c
+}
@@ -96,7 +96,7 @@ func NewFullyConnectedLayer(def LayerDef) Layer {
 	}
 
 	biases := volume.NewVolume(volume.Dimensions{X: 1, Y: 1, Z: outDepth}, volume.WithInitialValue(bias))
-	return &fullyConnLayer{conf, def.Input, outDim, nil, nil, filters, biases}
+	return &fullyConnLayer{conf, def.Input, outDim, nil, nil, nil, nil, filters, biases, false}
 }
 
 type fullyConnLayer struct {
@@ -107,8 +107,14 @@ type fullyConnLayer struct {
 	inVol  *volume.Volume
 	outVol *volume.Volume
 
+	inBatch  *volume.Batch
+	outBatch *volume.Batch
+
 	filters []*volume.Volume
 	biases  *volume.Volume
+
+	// shared is set when the parameters belong to another layer
+	shared bool
 }
 
 func (*fullyConnLayer) Type() LayerType {
@@ -149,7 +155,56 @@ func (l *fullyConnLayer) Backward() {
 	}
 }
 
+// ForwardBatch computes the outputs of every sample of the batch in one pass
+// over the filters.
+func (l *fullyConnLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	l.inBatch = b
+	A := volume.NewBatch(b.N(), l.output)
+
+	w, a := b.Weights(), A.Weights()
+	numInputs, numOutputs := l.input.Size(), l.output.Size()
+	for i := 0; i < numOutputs; i++ {
+		wi := l.filters[i].Weights()
+		bias := l.biases.GetByIndex(i)
+		for s := 0; s < b.N(); s++ {
+			x := w[s*numInputs : (s+1)*numInputs]
+			var sum float64
+			for d := 0; d < numInputs; d++ {
+				sum += x[d] * wi[d]
+			}
+			a[s*numOutputs+i] = sum + bias
+		}
+	}
+
+	l.outBatch = A
+	return l.outBatch
+}
+
+func (l *fullyConnLayer) BackwardBatch() {
+	l.inBatch.ZeroGrad()
+
+	w, dw := l.inBatch.Weights(), l.inBatch.Gradients()
+	chainGrads := l.outBatch.Gradients()
+	numInputs, numOutputs := l.input.Size(), l.output.Size()
+	for i := 0; i < numOutputs; i++ {
+		wi, dwi := l.filters[i].Weights(), l.filters[i].Gradients()
+		for s := 0; s < l.inBatch.N(); s++ {
+			chainGrad := chainGrads[s*numOutputs+i]
+			offset := s * numInputs
+			for d := 0; d < numInputs; d++ {
+				dw[offset+d] += wi[d] * chainGrad
+				dwi[d] += w[offset+d] * chainGrad
+			}
+			l.biases.AddGradByIndex(i, chainGrad)
+		}
+	}
+}
+
 func (l *fullyConnLayer) GetResponse() []LayerResponse {
+	if l.shared {
+		return []LayerResponse{}
+	}
+
 	var resp []LayerResponse
 	for i := 0; i < l.output.Z; i++ {
 		resp = append(resp, LayerResponse{
@@ -167,3 +222,18 @@ func (l *fullyConnLayer) GetResponse() []LayerResponse {
 	})
 	return resp
 }
+
+// Clone returns a copy whose parameters share the weights of the layer. The
+// parameters of a layer which shares the weights of another layer must be
+// linked again with ShareWeights.
+func (l *fullyConnLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	c.inBatch, c.outBatch = nil, nil
+	c.filters = make([]*volume.Volume, len(l.filters))
+	for i, f := range l.filters {
+		c.filters[i] = f.CloneShared()
+	}
+	c.biases = l.biases.CloneShared()
+	return &c
+}
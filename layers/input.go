@@ -31,9 +31,23 @@ func (il *inputLayer) Forward(vol *volume.Volume, training bool) *volume.Volume
 }
 
 func (il *inputLayer) Backward() {
-	panic(fmt.Errorf("Unsupported operation"))
+	// gradients stop at the input layer
 }
 
 func (il *inputLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (il *inputLayer) Clone() Layer {
+	c := *il
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
+
+func (il *inputLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	return b
+}
+
+func (il *inputLayer) BackwardBatch() {
+	// gradients stop at the input layer
+}
@@ -1,6 +1,10 @@
 package layers
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
+
 	"github.com/eliquious/reticulum/volume"
 )
 
@@ -22,6 +26,21 @@ const (
 	Tanh              LayerType = "tanh"
 	Maxout            LayerType = "maxout"
 	SVM               LayerType = "svm"
+	Add               LayerType = "add"
+	Multiply          LayerType = "multiply"
+	Concat            LayerType = "concat"
+	Split             LayerType = "split"
+	MultiLabel        LayerType = "multilabel"
+)
+
+// Axis selects one of the dimensions of a volume
+type Axis string
+
+// Axis enums
+const (
+	AxisX Axis = "x"
+	AxisY Axis = "y"
+	AxisZ Axis = "z"
 )
 
 // LayerConfig stores layer specific config
@@ -34,9 +53,15 @@ type LayerOptionFunc func(LayerConfig) error
 type LayerDef struct {
 	Type LayerType
 
+	// Name identifies the layer within a graph network
+	Name string
+
 	// Input dimensions
 	Input volume.Dimensions
 
+	// Inputs contains the dimensions of every incoming volume for merge layers
+	Inputs []volume.Dimensions
+
 	// Output dim
 	Output volume.Dimensions
 
@@ -51,6 +76,10 @@ type LayerDef struct {
 
 	// LayerConfig contains layer specific requirements
 	LayerConfig LayerConfig
+
+	// ShareWeightsWith names a layer of the same type and size whose
+	// parameters are used by this layer instead of its own
+	ShareWeightsWith string
 }
 
 // Layer represents a layer in the neural network.
@@ -59,6 +88,27 @@ type Layer interface {
 	Forward(vol *volume.Volume, training bool) *volume.Volume
 	Backward()
 	GetResponse() []LayerResponse
+
+	// Clone returns a copy of the layer for use in another goroutine. The
+	// copy shares the weights of the layer but accumulates its own gradients.
+	Clone() Layer
+}
+
+// MergeLayer extends the Layer interface for layers which combine several
+// input volumes into one. Backward distributes the gradient to every input.
+type MergeLayer interface {
+	Layer
+	ForwardMerge(vols []*volume.Volume, training bool) *volume.Volume
+}
+
+// BatchLayer extends the Layer interface for layers which process a whole
+// mini-batch in one pass. BackwardBatch distributes the gradients of the last
+// output batch to the input batch and accumulates the parameter gradients of
+// every sample.
+type BatchLayer interface {
+	Layer
+	ForwardBatch(b *volume.Batch, training bool) *volume.Batch
+	BackwardBatch()
 }
 
 // LossLayer extends the Layer interface with the Loss function
@@ -74,6 +124,28 @@ type RegressionLossLayer interface {
 	DimensionalLoss(index int, value float64) float64
 }
 
+// MultiLabelLossLayer extends the Layer interface with a loss over
+// independent binary labels
+type MultiLabelLossLayer interface {
+	Layer
+	Loss(y []float64) float64
+}
+
+// DistributionLossLayer extends the Layer interface with a loss against a
+// target probability distribution
+type DistributionLossLayer interface {
+	Layer
+	LossDistribution(p []float64) float64
+}
+
+// RandomLayer extends the Layer interface for layers which sample random
+// numbers during training. By default they use the global source of
+// math/rand.
+type RandomLayer interface {
+	Layer
+	SetRand(r *rand.Rand)
+}
+
 // LayerResponse represents the layer parameters (weights) and gradients.
 type LayerResponse struct {
 	Weights    []float64
@@ -82,6 +154,37 @@ type LayerResponse struct {
 	L2DecayMul float64
 }
 
+// ShareWeights replaces the parameters of the layer with the parameters of
+// other. Gradients from both layers accumulate into the shared parameters,
+// which are only reported by the GetResponse of other.
+func ShareWeights(layer, other Layer) error {
+	switch l := layer.(type) {
+	case *fullyConnLayer:
+		o, ok := other.(*fullyConnLayer)
+		if !ok {
+			return fmt.Errorf("cannot share weights between %s and %s layers", layer.Type(), other.Type())
+		} else if l.input.Size() != o.input.Size() || l.output != o.output {
+			return fmt.Errorf("cannot share weights between fc layers of different sizes")
+		} else if o.shared {
+			return fmt.Errorf("cannot share weights with a layer which shares its weights")
+		}
+		l.filters, l.biases, l.shared = o.filters, o.biases, true
+	case *convLayer:
+		o, ok := other.(*convLayer)
+		if !ok {
+			return fmt.Errorf("cannot share weights between %s and %s layers", layer.Type(), other.Type())
+		} else if l.input.Z != o.input.Z || l.output.Z != o.output.Z || l.conf.Sx != o.conf.Sx || l.conf.Sy != o.conf.Sy {
+			return fmt.Errorf("cannot share weights between conv layers of different sizes")
+		} else if o.shared {
+			return fmt.Errorf("cannot share weights with a layer which shares its weights")
+		}
+		l.filters, l.biases, l.shared = o.filters, o.biases, true
+	default:
+		return fmt.Errorf("%s layer has no weights to share", layer.Type())
+	}
+	return nil
+}
+
 // ActivateLayers adds activation, dropout layers, etc.
 func ActivateLayers(defs []LayerDef) []LayerDef {
 	var newDefs []LayerDef
@@ -89,7 +192,7 @@ func ActivateLayers(defs []LayerDef) []LayerDef {
 
 		// add an fc layer here, there is no reason the user should
 		// have to worry about this and we almost always want to
-		if def.Type == SoftMax || def.Type == SVM {
+		if def.Type == SoftMax || def.Type == SVM || def.Type == MultiLabel {
 			switch conf := def.LayerConfig.(type) {
 			case *softMaxLayerConfig:
 				newDefs = append(newDefs, LayerDef{
@@ -101,6 +204,11 @@ func ActivateLayers(defs []LayerDef) []LayerDef {
 					Type:        FullyConnected,
 					LayerConfig: NewFullyConnectedLayerConfig(conf.Classes),
 				})
+			case *multiLabelLayerConfig:
+				newDefs = append(newDefs, LayerDef{
+					Type:        FullyConnected,
+					LayerConfig: NewFullyConnectedLayerConfig(conf.Classes),
+				})
 			default:
 				panic("invalid LayerConfig")
 			}
@@ -154,7 +262,7 @@ func ActivateLayers(defs []LayerDef) []LayerDef {
 				}
 				newDefs = append(newDefs, LayerDef{
 					Type: Maxout,
-					LayerConfig: MaxoutLayerConfig{
+					LayerConfig: &MaxoutLayerConfig{
 						GroupSize: groupSize,
 					},
 				})
@@ -173,3 +281,105 @@ func ActivateLayers(defs []LayerDef) []LayerDef {
 	}
 	return newDefs
 }
+
+// OutputDimensions returns the dimensions of the volume produced by the layer
+// described by def, given its input dimensions.
+func OutputDimensions(def LayerDef) (volume.Dimensions, error) {
+	switch def.Type {
+	case Input:
+		return def.Output, nil
+	case FullyConnected:
+		conf, ok := def.LayerConfig.(*fullyConnLayerConfig)
+		if !ok {
+			return volume.Dimensions{}, fmt.Errorf("invalid LayerConfig for fc layer")
+		}
+		return volume.NewDimensions(1, 1, conf.Neurons), nil
+	case Conv:
+		conf, ok := def.LayerConfig.(*convLayerConfig)
+		if !ok {
+			return volume.Dimensions{}, fmt.Errorf("invalid LayerConfig for conv layer")
+		}
+		sy := conf.Sy
+		if sy <= 0 {
+			sy = conf.Sx
+		}
+		outSx := math.Floor((float64(def.Input.X)+float64(conf.Padding)*2.0-float64(conf.Sx))/float64(conf.Stride) + 1)
+		outSy := math.Floor((float64(def.Input.Y)+float64(conf.Padding)*2.0-float64(sy))/float64(conf.Stride) + 1)
+		return volume.NewDimensions(int(outSx), int(outSy), conf.FilterCount), nil
+	case Pool:
+		conf, ok := def.LayerConfig.(*poolLayerConfig)
+		if !ok {
+			return volume.Dimensions{}, fmt.Errorf("invalid LayerConfig for pool layer")
+		}
+		sy := conf.Sy
+		if sy <= 0 {
+			sy = conf.Sx
+		}
+		outSx := math.Floor((float64(def.Input.X)+float64(conf.Padding)*2.0-float64(conf.Sx))/float64(conf.Stride) + 1)
+		outSy := math.Floor((float64(def.Input.Y)+float64(conf.Padding)*2.0-float64(sy))/float64(conf.Stride) + 1)
+		return volume.NewDimensions(int(outSx), int(outSy), def.Input.Z), nil
+	case Maxout:
+		conf, ok := def.LayerConfig.(*MaxoutLayerConfig)
+		if !ok || conf.GroupSize <= 0 {
+			return volume.Dimensions{}, fmt.Errorf("invalid LayerConfig for maxout layer")
+		}
+		return volume.NewDimensions(def.Input.X, def.Input.Y, def.Input.Z/conf.GroupSize), nil
+	case ReLU, Sigmoid, Tanh, Dropout:
+		return def.Input, nil
+	case SoftMax, SVM, Regression, MultiLabel:
+		return volume.NewDimensions(1, 1, def.Input.Size()), nil
+	case Add, Multiply:
+		if len(def.Inputs) == 0 {
+			return volume.Dimensions{}, fmt.Errorf("%s layer requires at least one input", def.Type)
+		}
+		for _, dim := range def.Inputs[1:] {
+			if dim != def.Inputs[0] {
+				return volume.Dimensions{}, fmt.Errorf("%s layer inputs must have equal dimensions: %v != %v", def.Type, dim, def.Inputs[0])
+			}
+		}
+		return def.Inputs[0], nil
+	case Concat:
+		if len(def.Inputs) == 0 {
+			return volume.Dimensions{}, fmt.Errorf("concat layer requires at least one input")
+		}
+		axis, err := concatAxis(def.LayerConfig)
+		if err != nil {
+			return volume.Dimensions{}, err
+		}
+		out := def.Inputs[0]
+		for _, dim := range def.Inputs[1:] {
+			switch axis {
+			case AxisX:
+				if dim.Y != out.Y || dim.Z != out.Z {
+					return volume.Dimensions{}, fmt.Errorf("concat layer inputs must have equal Y and Z: %v != %v", dim, out)
+				}
+				out.X += dim.X
+			case AxisY:
+				if dim.X != out.X || dim.Z != out.Z {
+					return volume.Dimensions{}, fmt.Errorf("concat layer inputs must have equal X and Z: %v != %v", dim, out)
+				}
+				out.Y += dim.Y
+			default:
+				if dim.X != out.X || dim.Y != out.Y {
+					return volume.Dimensions{}, fmt.Errorf("concat layer inputs must have equal X and Y: %v != %v", dim, out)
+				}
+				out.Z += dim.Z
+			}
+		}
+		return out, nil
+	case Split:
+		conf, ok := def.LayerConfig.(*splitLayerConfig)
+		if !ok {
+			return volume.Dimensions{}, fmt.Errorf("invalid LayerConfig for split layer")
+		}
+		out := def.Input
+		length := axisLength(&out, conf.Axis)
+		if conf.Offset < 0 || conf.Size <= 0 || conf.Offset+conf.Size > *length {
+			return volume.Dimensions{}, fmt.Errorf("split range [%d, %d) is outside of axis %s with length %d", conf.Offset, conf.Offset+conf.Size, conf.Axis, *length)
+		}
+		*length = conf.Size
+		return out, nil
+	default:
+		return volume.Dimensions{}, fmt.Errorf("unrecognized layer type: %s", def.Type)
+	}
+}
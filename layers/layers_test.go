@@ -0,0 +1,61 @@
+package layers
+
+import (
+	"testing"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestInputLayer_Backward(t *testing.T) {
+	layer := NewInputLayer(LayerDef{Type: Input, Output: volume.NewDimensions(1, 1, 2)})
+	vol := volume.NewVolume(volume.NewDimensions(1, 1, 2), volume.WithWeights([]float64{1, 2}))
+	vol.SetGradByIndex(0, 0.5)
+	layer.Forward(vol, true)
+
+	// the backward pass through a whole network ends at the input layer
+	layer.Backward()
+	if g := vol.GetGradByIndex(0); g != 0.5 {
+		t.Errorf("input gradient = %v, want 0.5", g)
+	}
+}
+
+func TestActivateLayers_Maxout(t *testing.T) {
+	defs := ActivateLayers([]LayerDef{{Type: FullyConnected, Activation: Maxout, LayerConfig: NewFullyConnectedLayerConfig(4)}})
+	if len(defs) != 2 {
+		t.Fatalf("ActivateLayers() = %d layers, want 2", len(defs))
+	}
+
+	def := defs[1]
+	def.Input = volume.NewDimensions(1, 1, 4)
+	def.Output = volume.NewDimensions(1, 1, 2)
+	layer := NewMaxoutLayer(def)
+	out := layer.Forward(volume.NewVolume(def.Input, volume.WithWeights([]float64{1, 3, -2, -5})), false)
+	if out.GetByIndex(0) != 3 || out.GetByIndex(1) != -2 {
+		t.Errorf("Forward() = %v, want [3 -2]", out.Weights())
+	}
+}
+
+func TestPoolLayer_Forward(t *testing.T) {
+	dim := volume.NewDimensions(4, 4, 1)
+	layer := NewPoolLayer(LayerDef{Type: Pool, Input: dim, Output: dim, LayerConfig: NewPoolLayerConfig(2)})
+	vol := volume.NewVolume(dim, volume.WithZeros())
+	for i := 0; i < vol.Size(); i++ {
+		vol.SetByIndex(i, float64(i))
+	}
+
+	// the windows start at the corner and move by the stride
+	out := layer.Forward(vol, true)
+	want := []float64{vol.Get(1, 1, 0), vol.Get(1, 3, 0), vol.Get(3, 1, 0), vol.Get(3, 3, 0)}
+	got := []float64{out.Get(0, 0, 0), out.Get(0, 1, 0), out.Get(1, 0, 0), out.Get(1, 1, 0)}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Forward() = %v, want %v", got, want)
+		}
+	}
+
+	out.SetGrad(1, 1, 0, 1)
+	layer.Backward()
+	if g := vol.GetGrad(3, 3, 0); g != 1 {
+		t.Errorf("input gradient = %v, want 1", g)
+	}
+}
@@ -0,0 +1,165 @@
+package layers
+
+import (
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// checkInputGradients compares the input gradient written by loss against
+// central differences of the loss with respect to each input.
+func checkInputGradients(t *testing.T, layer Layer, x []float64, loss func() float64) {
+	vol := volume.NewVolume(volume.NewDimensions(1, 1, len(x)), volume.WithWeights(x))
+	layer.Forward(vol, true)
+	loss()
+	grads := append([]float64(nil), vol.Gradients()...)
+
+	const h = 1e-6
+	for i := range x {
+		want := vol.GetByIndex(i)
+		vol.SetByIndex(i, want+h)
+		layer.Forward(vol, true)
+		lp := loss()
+		vol.SetByIndex(i, want-h)
+		layer.Forward(vol, true)
+		lm := loss()
+		vol.SetByIndex(i, want)
+
+		numeric := (lp - lm) / (2 * h)
+		if math.Abs(numeric-grads[i]) > 1e-5 {
+			t.Fatalf("gradient[%d] = %v, want %v", i, grads[i], numeric)
+		}
+	}
+}
+
+func TestMultiLabelLayer_Loss(t *testing.T) {
+	def := LayerDef{Type: MultiLabel, Input: volume.NewDimensions(1, 1, 4), LayerConfig: NewMultiLabelLayerConfig(4)}
+	layer := NewMultiLabelLayer(def).(MultiLabelLossLayer)
+
+	y := []float64{1, 0, 0.3, 1}
+	checkInputGradients(t, layer, []float64{2.0, -1.0, 0.5, -3.0}, func() float64 { return layer.Loss(y) })
+
+	// saturated logits must not overflow
+	vol := volume.NewVolume(volume.NewDimensions(1, 1, 4), volume.WithWeights([]float64{800, -800, 0, 0}))
+	layer.Forward(vol, false)
+	if loss := layer.Loss([]float64{0, 1, 0, 1}); math.IsInf(loss, 0) || math.IsNaN(loss) || math.Abs(loss-1600-2*math.Ln2) > 1e-9 {
+		t.Errorf("Loss() = %v, want %v", loss, 1600+2*math.Ln2)
+	}
+}
+
+func TestRegressionLayer_Losses(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  LayerOptionFunc
+	}{
+		{"squared", WithRegressionLoss(SquaredLoss)},
+		{"l1", WithRegressionLoss(AbsoluteLoss)},
+		{"huber", WithHuberDelta(0.5)},
+		{"logcosh", WithRegressionLoss(LogCoshLoss)},
+		{"quantile", WithQuantiles(0.1, 0.5, 0.9)},
+	}
+
+	y := []float64{0.3, 0.3, 0.3}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := LayerDef{Type: Regression, Input: volume.NewDimensions(1, 1, 3), LayerConfig: NewRegressionLayerConfig(3, tt.opt)}
+			layer := NewRegressionLayer(def).(RegressionLossLayer)
+			checkInputGradients(t, layer, []float64{1.2, -0.4, 0.45}, func() float64 { return layer.MultiDimensionalLoss(y) })
+		})
+	}
+}
+
+func TestSoftmaxLayer_Loss(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []LayerOptionFunc
+	}{
+		{"plain", nil},
+		{"weighted", []LayerOptionFunc{WithClassWeights(0.5, 2.0, 1.0, 4.0)}},
+		{"focal", []LayerOptionFunc{WithFocalLoss(2.0)}},
+		{"focal fractional", []LayerOptionFunc{WithFocalLoss(0.5)}},
+		{"smoothed", []LayerOptionFunc{WithLabelSmoothing(0.1)}},
+		{"all", []LayerOptionFunc{WithClassWeights(0.5, 2.0, 1.0, 4.0), WithFocalLoss(2.0), WithLabelSmoothing(0.1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := LayerDef{Type: SoftMax, Input: volume.NewDimensions(1, 1, 4), LayerConfig: NewSoftmaxLayerConfig(4, tt.opts...)}
+			layer := NewSoftmaxLayer(def).(LossLayer)
+			checkInputGradients(t, layer, []float64{1.2, -0.4, 0.45, 2.0}, func() float64 { return layer.Loss(1) })
+		})
+	}
+}
+
+func TestSoftmaxLayer_LossDistribution(t *testing.T) {
+	p := []float64{0.1, 0.6, 0.05, 0.25}
+	for _, T := range []float64{1.0, 3.0} {
+		def := LayerDef{Type: SoftMax, Input: volume.NewDimensions(1, 1, 4), LayerConfig: NewSoftmaxLayerConfig(4, WithTemperature(T))}
+		layer := NewSoftmaxLayer(def).(DistributionLossLayer)
+		checkInputGradients(t, layer, []float64{1.2, -0.4, 0.45, 2.0}, func() float64 { return layer.LossDistribution(p) })
+	}
+}
+
+func TestSVMLayer_Loss(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []LayerOptionFunc
+	}{
+		{"hinge", nil},
+		{"margin", []LayerOptionFunc{WithMargin(2.0)}},
+		{"squared", []LayerOptionFunc{WithSquaredHinge()}},
+		{"one-vs-rest", []LayerOptionFunc{WithOneVsRest()}},
+		{"squared one-vs-rest", []LayerOptionFunc{WithOneVsRest(), WithSquaredHinge(), WithMargin(0.5)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := LayerDef{Type: SVM, Input: volume.NewDimensions(1, 1, 4), LayerConfig: NewSVMLayerConfig(4, tt.opts...)}
+			layer := NewSVMLayer(def).(LossLayer)
+			checkInputGradients(t, layer, []float64{1.2, -0.4, 0.45, 2.0}, func() float64 { return layer.Loss(1) })
+		})
+	}
+}
+
+func TestMetricLosses(t *testing.T) {
+	embed := func(w ...float64) *volume.Volume {
+		return volume.NewVolume(volume.NewDimensions(1, 1, len(w)), volume.WithWeights(w))
+	}
+	tests := []struct {
+		name string
+		vols []*volume.Volume
+		loss func(v []*volume.Volume) float64
+	}{
+		{"similar", []*volume.Volume{embed(0.1, 0.5, -0.2), embed(0.4, -0.1, 0.3)}, func(v []*volume.Volume) float64 { return ContrastiveLoss(v[0], v[1], true, 1.0) }},
+		{"dissimilar", []*volume.Volume{embed(0.1, 0.5, -0.2), embed(0.4, -0.1, 0.3)}, func(v []*volume.Volume) float64 { return ContrastiveLoss(v[0], v[1], false, 2.0) }},
+		{"triplet", []*volume.Volume{embed(0.1, 0.5, -0.2), embed(0.4, -0.1, 0.3), embed(0.2, 0.4, 0.0)}, func(v []*volume.Volume) float64 { return TripletLoss(v[0], v[1], v[2], 0.5) }},
+	}
+
+	const h = 1e-6
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.loss(tt.vols)
+			var grads [][]float64
+			for _, v := range tt.vols {
+				grads = append(grads, append([]float64(nil), v.Gradients()...))
+			}
+
+			for k, v := range tt.vols {
+				for i := 0; i < v.Size(); i++ {
+					want := v.GetByIndex(i)
+					v.SetByIndex(i, want+h)
+					lp := tt.loss(tt.vols)
+					v.SetByIndex(i, want-h)
+					lm := tt.loss(tt.vols)
+					v.SetByIndex(i, want)
+
+					numeric := (lp - lm) / (2 * h)
+					if math.Abs(numeric-grads[k][i]) > 1e-5 {
+						t.Fatalf("gradient[%d][%d] = %v, want %v", k, i, grads[k][i], numeric)
+					}
+				}
+			}
+		})
+	}
+}
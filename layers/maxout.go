@@ -50,7 +50,7 @@ func (l *maxoutLayer) Type() LayerType {
 func (l *maxoutLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 
 	l.inVol = vol
-	v2 := l.outVol.CloneAndZero()
+	v2 := volume.NewVolume(l.output, volume.WithZeros())
 	n := l.output.Z
 
 	// optimization branch. If we're operating on 1D arrays we dont have
@@ -89,7 +89,7 @@ func (l *maxoutLayer) Forward(vol *volume.Volume, training bool) *volume.Volume
 						}
 					}
 					v2.Set(x, y, i, a)
-					l.switches[n] = ix + ai
+					l.switches[si] = ix + ai
 					si++
 				}
 			}
@@ -130,3 +130,10 @@ func (l *maxoutLayer) Backward() {
 func (l *maxoutLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *maxoutLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	c.switches = make([]int, len(l.switches))
+	return &c
+}
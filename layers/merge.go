@@ -0,0 +1,251 @@
+package layers
+
+import (
+	"fmt"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// NewAddLayer creates a new layer which sums its input volumes element-wise.
+func NewAddLayer(def LayerDef) Layer {
+	if def.Type != Add {
+		panic(fmt.Errorf("Invalid layer type: %s != add", def.Type))
+	} else if def.Output.Z == 0 {
+		panic(fmt.Errorf("Output depth cannot be 0 for add layer"))
+	}
+	return &addLayer{def.Output, nil, nil}
+}
+
+type addLayer struct {
+	output volume.Dimensions
+
+	inVols []*volume.Volume
+	outVol *volume.Volume
+}
+
+func (*addLayer) Type() LayerType {
+	return Add
+}
+
+func (l *addLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	return l.ForwardMerge([]*volume.Volume{vol}, training)
+}
+
+func (l *addLayer) ForwardMerge(vols []*volume.Volume, training bool) *volume.Volume {
+	l.inVols = vols
+	A := volume.NewVolume(l.output, volume.WithZeros())
+	for _, vol := range vols {
+		A.AddFrom(vol)
+	}
+
+	l.outVol = A
+	return l.outVol
+}
+
+func (l *addLayer) Backward() {
+	n := l.outVol.Size()
+
+	// the gradient of a sum flows unchanged to every input
+	for _, vol := range l.inVols {
+		vol.ZeroGrad()
+		for i := 0; i < n; i++ {
+			vol.SetGradByIndex(i, l.outVol.GetGradByIndex(i))
+		}
+	}
+}
+
+func (*addLayer) GetResponse() []LayerResponse {
+	return []LayerResponse{}
+}
+
+// NewMultiplyLayer creates a new layer which multiplies its input volumes element-wise.
+func NewMultiplyLayer(def LayerDef) Layer {
+	if def.Type != Multiply {
+		panic(fmt.Errorf("Invalid layer type: %s != multiply", def.Type))
+	} else if def.Output.Z == 0 {
+		panic(fmt.Errorf("Output depth cannot be 0 for multiply layer"))
+	}
+	return &multiplyLayer{def.Output, nil, nil}
+}
+
+type multiplyLayer struct {
+	output volume.Dimensions
+
+	inVols []*volume.Volume
+	outVol *volume.Volume
+}
+
+func (*multiplyLayer) Type() LayerType {
+	return Multiply
+}
+
+func (l *multiplyLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	return l.ForwardMerge([]*volume.Volume{vol}, training)
+}
+
+func (l *multiplyLayer) ForwardMerge(vols []*volume.Volume, training bool) *volume.Volume {
+	l.inVols = vols
+	A := volume.NewVolume(l.output, volume.WithInitialValue(1.0))
+
+	n := A.Size()
+	for _, vol := range vols {
+		for i := 0; i < n; i++ {
+			A.MultByIndex(i, vol.GetByIndex(i))
+		}
+	}
+
+	l.outVol = A
+	return l.outVol
+}
+
+func (l *multiplyLayer) Backward() {
+	n := l.outVol.Size()
+	for k, vol := range l.inVols {
+		vol.ZeroGrad()
+		for i := 0; i < n; i++ {
+
+			// product of every other input. This is recomputed rather than
+			// divided out of the output so that zero inputs are handled.
+			p := l.outVol.GetGradByIndex(i)
+			for j, other := range l.inVols {
+				if j != k {
+					p *= other.GetByIndex(i)
+				}
+			}
+			vol.SetGradByIndex(i, p)
+		}
+	}
+}
+
+func (*multiplyLayer) GetResponse() []LayerResponse {
+	return []LayerResponse{}
+}
+
+// NewConcatLayerConfig creates a new concat config joining the inputs along the given axis.
+func NewConcatLayerConfig(axis Axis, opts ...LayerOptionFunc) LayerConfig {
+	if axis != AxisX && axis != AxisY && axis != AxisZ {
+		panic(fmt.Errorf("invalid concat axis: %s", axis))
+	}
+
+	conf := &concatLayerConfig{
+		Axis: axis,
+	}
+	for i := 0; i < len(opts); i++ {
+		err := opts[i](conf)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return conf
+}
+
+// concatLayerConfig stores the config info for concat layers
+type concatLayerConfig struct {
+	Axis Axis
+}
+
+// concatAxis returns the axis of a concat config. Concat layers without a
+// config join their inputs along the depth.
+func concatAxis(lc LayerConfig) (Axis, error) {
+	if lc == nil {
+		return AxisZ, nil
+	}
+	conf, ok := lc.(*concatLayerConfig)
+	if !ok {
+		return "", fmt.Errorf("invalid LayerConfig for concat layer")
+	}
+	return conf.Axis, nil
+}
+
+// NewConcatLayer creates a new layer which joins its input volumes along an
+// axis. The remaining dimensions of the inputs must match. Without a config
+// the inputs are stacked along the depth.
+func NewConcatLayer(def LayerDef) Layer {
+	if def.Type != Concat {
+		panic(fmt.Errorf("Invalid layer type: %s != concat", def.Type))
+	} else if def.Output.Z == 0 {
+		panic(fmt.Errorf("Output depth cannot be 0 for concat layer"))
+	}
+
+	axis, err := concatAxis(def.LayerConfig)
+	if err != nil {
+		panic(err)
+	}
+	return &concatLayer{axis, def.Output, nil, nil}
+}
+
+type concatLayer struct {
+	axis   Axis
+	output volume.Dimensions
+
+	inVols []*volume.Volume
+	outVol *volume.Volume
+}
+
+func (*concatLayer) Type() LayerType {
+	return Concat
+}
+
+func (l *concatLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	return l.ForwardMerge([]*volume.Volume{vol}, training)
+}
+
+func (l *concatLayer) ForwardMerge(vols []*volume.Volume, training bool) *volume.Volume {
+	l.inVols = vols
+	A := volume.NewVolume(l.output, volume.WithZeros())
+
+	var offset volume.Dimensions
+	for _, vol := range vols {
+		dim := vol.Dimensions()
+		for x := 0; x < dim.X; x++ {
+			for y := 0; y < dim.Y; y++ {
+				for d := 0; d < dim.Z; d++ {
+					A.Set(offset.X+x, offset.Y+y, offset.Z+d, vol.Get(x, y, d))
+				}
+			}
+		}
+		*axisLength(&offset, l.axis) += *axisLength(&dim, l.axis)
+	}
+
+	l.outVol = A
+	return l.outVol
+}
+
+func (l *concatLayer) Backward() {
+	var offset volume.Dimensions
+	for _, vol := range l.inVols {
+		vol.ZeroGrad()
+
+		dim := vol.Dimensions()
+		for x := 0; x < dim.X; x++ {
+			for y := 0; y < dim.Y; y++ {
+				for d := 0; d < dim.Z; d++ {
+					vol.SetGrad(x, y, d, l.outVol.GetGrad(offset.X+x, offset.Y+y, offset.Z+d))
+				}
+			}
+		}
+		*axisLength(&offset, l.axis) += *axisLength(&dim, l.axis)
+	}
+}
+
+func (*concatLayer) GetResponse() []LayerResponse {
+	return []LayerResponse{}
+}
+
+func (l *addLayer) Clone() Layer {
+	c := *l
+	c.inVols, c.outVol = nil, nil
+	return &c
+}
+
+func (l *multiplyLayer) Clone() Layer {
+	c := *l
+	c.inVols, c.outVol = nil, nil
+	return &c
+}
+
+func (l *concatLayer) Clone() Layer {
+	c := *l
+	c.inVols, c.outVol = nil, nil
+	return &c
+}
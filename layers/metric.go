@@ -0,0 +1,87 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// ContrastiveLoss computes the contrastive loss for a pair of embeddings and
+// writes its gradient into both volumes. Similar pairs are pulled together
+// while dissimilar pairs are pushed apart until their distance reaches the
+// margin.
+func ContrastiveLoss(a, b *volume.Volume, similar bool, margin float64) float64 {
+	if a.Size() != b.Size() {
+		panic(fmt.Errorf("Invalid embedding sizes: %d != %d", a.Size(), b.Size()))
+	}
+	a.ZeroGrad()
+	b.ZeroGrad()
+
+	n := a.Size()
+	var d2 float64
+	for i := 0; i < n; i++ {
+		diff := a.GetByIndex(i) - b.GetByIndex(i)
+		d2 += diff * diff
+	}
+
+	if similar {
+		for i := 0; i < n; i++ {
+			diff := a.GetByIndex(i) - b.GetByIndex(i)
+			a.SetGradByIndex(i, diff)
+			b.SetGradByIndex(i, -diff)
+		}
+		return 0.5 * d2
+	}
+
+	d := math.Sqrt(d2)
+	if d >= margin {
+		return 0
+	} else if d == 0 {
+		// identical embeddings have no direction to be pushed in
+		return 0.5 * margin * margin
+	}
+
+	scale := -(margin - d) / d
+	for i := 0; i < n; i++ {
+		diff := a.GetByIndex(i) - b.GetByIndex(i)
+		a.SetGradByIndex(i, scale*diff)
+		b.SetGradByIndex(i, -scale*diff)
+	}
+	return 0.5 * (margin - d) * (margin - d)
+}
+
+// TripletLoss computes the triplet margin loss for an anchor, a positive and
+// a negative embedding and writes its gradient into all three volumes. The
+// squared distance from the anchor to the negative must exceed the squared
+// distance to the positive by the margin.
+func TripletLoss(anchor, positive, negative *volume.Volume, margin float64) float64 {
+	if anchor.Size() != positive.Size() || anchor.Size() != negative.Size() {
+		panic(fmt.Errorf("Invalid embedding sizes: %d, %d, %d", anchor.Size(), positive.Size(), negative.Size()))
+	}
+	anchor.ZeroGrad()
+	positive.ZeroGrad()
+	negative.ZeroGrad()
+
+	n := anchor.Size()
+	var dp, dn float64
+	for i := 0; i < n; i++ {
+		ap := anchor.GetByIndex(i) - positive.GetByIndex(i)
+		an := anchor.GetByIndex(i) - negative.GetByIndex(i)
+		dp += ap * ap
+		dn += an * an
+	}
+
+	loss := dp - dn + margin
+	if loss <= 0 {
+		return 0
+	}
+
+	for i := 0; i < n; i++ {
+		a, p, q := anchor.GetByIndex(i), positive.GetByIndex(i), negative.GetByIndex(i)
+		anchor.SetGradByIndex(i, 2*(q-p))
+		positive.SetGradByIndex(i, -2*(a-p))
+		negative.SetGradByIndex(i, 2*(a-q))
+	}
+	return loss
+}
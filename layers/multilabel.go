@@ -0,0 +1,116 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// NewMultiLabelLayer creates a new multi-label layer.
+// This is a classifier for N independent binary labels. It computes the
+// sigmoid of each of its N inputs as the probability that the label applies
+// and is trained with the binary cross entropy of every label.
+func NewMultiLabelLayer(def LayerDef) Layer {
+	if def.Type != MultiLabel {
+		panic(fmt.Errorf("invalid layer type: %s != multilabel", def.Type))
+	}
+
+	// Get config
+	conf, ok := def.LayerConfig.(*multiLabelLayerConfig)
+	if !ok {
+		panic("invalid LayerConfig for multiLabelLayerConfig")
+	}
+
+	n := def.Input.Size()
+	return &multiLabelLayer{conf, def.Input, volume.NewDimensions(1, 1, n), nil, nil}
+}
+
+// NewMultiLabelLayerConfig creates a new LayerConfig config with the given options.
+func NewMultiLabelLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
+	if classes <= 0 {
+		panic("class count must be greater than 0")
+	}
+
+	conf := &multiLabelLayerConfig{
+		Classes: classes,
+	}
+	for i := 0; i < len(opts); i++ {
+		err := opts[i](conf)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return conf
+}
+
+// multiLabelLayerConfig stores the config info for multi-label layers
+type multiLabelLayerConfig struct {
+	Classes int
+}
+
+type multiLabelLayer struct {
+	conf   *multiLabelLayerConfig
+	inDim  volume.Dimensions
+	outDim volume.Dimensions
+
+	inVol  *volume.Volume
+	outVol *volume.Volume
+}
+
+func (l *multiLabelLayer) Type() LayerType {
+	return MultiLabel
+}
+
+func (l *multiLabelLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	l.inVol = vol
+	A := volume.NewVolume(l.outDim, volume.WithZeros())
+
+	n := l.outDim.Z
+	for i := 0; i < n; i++ {
+		A.SetByIndex(i, 1.0/(1.0+math.Exp(-vol.GetByIndex(i))))
+	}
+
+	l.outVol = A
+	return l.outVol
+}
+
+// Loss computes the binary cross entropy for the targets, which are the
+// probabilities of each label in [0, 1]. Hard labels are given as 0 or 1.
+func (l *multiLabelLayer) Loss(y []float64) float64 {
+	if len(y) != l.outDim.Size() {
+		panic(fmt.Errorf("Invalid input length: %d != %d", len(y), l.outDim.Size()))
+	}
+
+	// compute and accumulate gradient wrt weights and bias of this layer
+	// zero out the gradient of input Vol
+	l.inVol.ZeroGrad()
+
+	var loss float64
+	for i := 0; i < l.outDim.Size(); i++ {
+		if y[i] < 0 || y[i] > 1 {
+			panic(fmt.Errorf("Invalid target probability: %v", y[i]))
+		}
+
+		// the cross entropy is computed from the logit rather than from
+		// the sigmoid so that it does not overflow for large activations
+		z := l.inVol.GetByIndex(i)
+		loss += math.Max(z, 0) - z*y[i] + math.Log1p(math.Exp(-math.Abs(z)))
+		l.inVol.SetGradByIndex(i, l.outVol.GetByIndex(i)-y[i])
+	}
+	return loss
+}
+
+func (l *multiLabelLayer) Backward() {
+	panic(fmt.Errorf("Unsupported operation"))
+}
+
+func (l *multiLabelLayer) GetResponse() []LayerResponse {
+	return []LayerResponse{}
+}
+
+func (l *multiLabelLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
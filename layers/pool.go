@@ -64,7 +64,7 @@ func NewPoolLayer(def LayerDef) Layer {
 	outSy := math.Floor((float64(def.Input.Y)+float64(conf.Padding)*2.0-float64(conf.Sy))/float64(conf.Stride) + 1)
 	outDim := volume.NewDimensions(int(outSx), int(outSy), outDepth)
 
-	return &poolLayer{conf, def.Input, outDim, nil, nil, make([]int, outDim.Size()), make([]int, outDim.Size())}
+	return &poolLayer{conf, def.Input, outDim, nil, nil, make([]int, outDim.Size()), make([]int, outDim.Size()), nil, nil, nil, nil}
 }
 
 type poolLayer struct {
@@ -77,6 +77,13 @@ type poolLayer struct {
 
 	switchX []int
 	switchY []int
+
+	inBatch  *volume.Batch
+	outBatch *volume.Batch
+
+	// switches of every sample of the last batch
+	batchX []int
+	batchY []int
 }
 
 func (*poolLayer) Type() LayerType {
@@ -85,16 +92,20 @@ func (*poolLayer) Type() LayerType {
 
 func (l *poolLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 	l.inVol = vol
-	A := volume.NewVolume(l.output, volume.WithZeros())
+	l.outVol = volume.NewVolume(l.output, volume.WithZeros())
+	l.pool(l.inVol, l.outVol, l.switchX, l.switchY)
+	return l.outVol
+}
 
+// pool writes the maximum of every window of in to out and stores where the
+// maximum came from in the switches.
+func (l *poolLayer) pool(in, out *volume.Volume, switchX, switchY []int) {
 	var n int
 	for d := 0; d < l.output.Z; d++ {
 		x := -l.conf.Padding
-		for ax := 0; ax < l.output.X; ax++ {
-			x += l.conf.Stride
+		for ax := 0; ax < l.output.X; ax, x = ax+1, x+l.conf.Stride {
 			y := -l.conf.Padding
-			for ay := 0; ay < l.output.Y; ay++ {
-				y += l.conf.Stride
+			for ay := 0; ay < l.output.Y; ay, y = ay+1, y+l.conf.Stride {
 
 				// convolve centered at this particular location
 				a := -1e5
@@ -104,7 +115,7 @@ func (l *poolLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 						oy := y + fy
 						ox := x + fx
 						if oy >= 0 && oy < l.input.Y && ox >= 0 && ox < l.input.X {
-							v := l.inVol.Get(ox, oy, d)
+							v := in.Get(ox, oy, d)
 							// perform max pooling and store pointers to where
 							// the max came from. This will speed up backprop
 							// and can help make nice visualizations in future
@@ -116,37 +127,67 @@ func (l *poolLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
 						}
 					}
 				}
-				l.switchX[n] = winX
-				l.switchY[n] = winY
+				switchX[n] = winX
+				switchY[n] = winY
 				n++
-				A.Set(ax, ay, d, a)
+				out.Set(ax, ay, d, a)
 			}
 		}
 	}
-
-	l.outVol = A
-	return l.outVol
 }
 
 func (l *poolLayer) Backward() {
 	l.inVol.ZeroGrad()
+	l.backward(l.inVol, l.outVol, l.switchX, l.switchY)
+}
 
+// backward routes the gradient of every output of out to the input of in
+// where its maximum came from.
+func (l *poolLayer) backward(in, out *volume.Volume, switchX, switchY []int) {
 	var n int
 	for d := 0; d < l.output.Z; d++ {
-		x := -l.conf.Padding
 		for ax := 0; ax < l.output.X; ax++ {
-			x += l.conf.Stride
-			y := -l.conf.Padding
 			for ay := 0; ay < l.output.Y; ay++ {
-				y += l.conf.Stride
-				chainGrad := l.outVol.GetGrad(ax, ay, d)
-				l.inVol.AddGrad(l.switchX[n], l.switchY[n], d, chainGrad)
+				chainGrad := out.GetGrad(ax, ay, d)
+				in.AddGrad(switchX[n], switchY[n], d, chainGrad)
 				n++
 			}
 		}
 	}
 }
 
+// ForwardBatch pools every sample of the batch into a single output batch.
+func (l *poolLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	size := l.output.Size()
+	if len(l.batchX) < b.N()*size {
+		l.batchX, l.batchY = make([]int, b.N()*size), make([]int, b.N()*size)
+	}
+
+	l.inBatch = b
+	l.outBatch = volume.NewBatch(b.N(), l.output)
+	for s := 0; s < b.N(); s++ {
+		l.pool(b.At(s), l.outBatch.At(s), l.batchX[s*size:(s+1)*size], l.batchY[s*size:(s+1)*size])
+	}
+	return l.outBatch
+}
+
+func (l *poolLayer) BackwardBatch() {
+	l.inBatch.ZeroGrad()
+	size := l.output.Size()
+	for s := 0; s < l.inBatch.N(); s++ {
+		l.backward(l.inBatch.At(s), l.outBatch.At(s), l.batchX[s*size:(s+1)*size], l.batchY[s*size:(s+1)*size])
+	}
+}
+
 func (l *poolLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *poolLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	c.switchX = make([]int, len(l.switchX))
+	c.switchY = make([]int, len(l.switchY))
+	c.inBatch, c.outBatch, c.batchX, c.batchY = nil, nil, nil, nil
+	return &c
+}
@@ -2,6 +2,7 @@ package layers
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/eliquious/reticulum/volume"
 )
@@ -22,14 +23,87 @@ func NewRegressionLayer(def LayerDef) Layer {
 	return &regressionLayer{conf, def.Input, volume.NewDimensions(1, 1, n), nil, nil}
 }
 
+// RegressionLoss selects the loss function of a regression layer
+type RegressionLoss string
+
+// RegressionLoss enums
+const (
+	SquaredLoss  RegressionLoss = "squared"
+	AbsoluteLoss RegressionLoss = "l1"
+	HuberLoss    RegressionLoss = "huber"
+	LogCoshLoss  RegressionLoss = "logcosh"
+	QuantileLoss RegressionLoss = "quantile"
+)
+
+// WithRegressionLoss sets the loss function of the regression layer
+func WithRegressionLoss(loss RegressionLoss) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*regressionLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for RegressionLayer loss")
+		}
+		switch loss {
+		case SquaredLoss, AbsoluteLoss, HuberLoss, LogCoshLoss, QuantileLoss:
+			conf.Loss = loss
+		default:
+			return fmt.Errorf("Invalid regression loss: %s", loss)
+		}
+		return nil
+	}
+}
+
+// WithHuberDelta uses the Huber loss with the given delta for the regression
+// layer. The loss is quadratic for errors up to delta and linear beyond it.
+// A delta of 1 is also known as the smooth L1 loss.
+func WithHuberDelta(delta float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*regressionLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for RegressionLayer Huber delta")
+		} else if delta <= 0 {
+			return fmt.Errorf("Huber delta must be greater than 0")
+		}
+		conf.Loss = HuberLoss
+		conf.Delta = delta
+		return nil
+	}
+}
+
+// WithQuantiles uses the pinball loss for the regression layer. A single
+// quantile applies to every neuron, otherwise there must be one quantile per
+// neuron. Prediction intervals are learned by giving each neuron a different
+// quantile and the same target value.
+func WithQuantiles(quantiles ...float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*regressionLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for RegressionLayer quantiles")
+		} else if len(quantiles) != 1 && len(quantiles) != conf.Neurons {
+			return fmt.Errorf("Invalid quantile count: %d != %d", len(quantiles), conf.Neurons)
+		}
+		for _, q := range quantiles {
+			if q <= 0 || q >= 1 {
+				return fmt.Errorf("Quantile must be between 0 and 1: %v", q)
+			}
+		}
+		conf.Loss = QuantileLoss
+		conf.Quantiles = quantiles
+		return nil
+	}
+}
+
 // NewRegressionLayerConfig creates a new LayerConfig config with the given options.
+// The squared error is used as the loss unless another loss is selected.
 func NewRegressionLayerConfig(neurons int, opts ...LayerOptionFunc) LayerConfig {
 	if neurons <= 0 {
 		panic("neuron count must be greater than 0")
 	}
 
 	conf := &regressionLayerConfig{
-		Neurons: neurons,
+		Neurons:   neurons,
+		Loss:      SquaredLoss,
+		Delta:     1.0,
+		Quantiles: []float64{0.5},
 	}
 	for i := 0; i < len(opts); i++ {
 		err := opts[i](conf)
@@ -42,7 +116,10 @@ func NewRegressionLayerConfig(neurons int, opts ...LayerOptionFunc) LayerConfig
 
 // regressionLayerConfig stores the config info for regression layers
 type regressionLayerConfig struct {
-	Neurons int
+	Neurons   int
+	Loss      RegressionLoss
+	Delta     float64
+	Quantiles []float64
 }
 
 type regressionLayer struct {
@@ -76,8 +153,9 @@ func (l *regressionLayer) MultiDimensionalLoss(y []float64) float64 {
 	var loss float64
 	for i := 0; i < l.outDim.Size(); i++ {
 		dY := l.inVol.GetByIndex(i) - y[i]
-		l.inVol.SetGradByIndex(i, dY)
-		loss += 0.5 * dY * dY
+		li, grad := l.loss(i, dY)
+		l.inVol.SetGradByIndex(i, grad)
+		loss += li
 	}
 	return loss
 }
@@ -93,13 +171,54 @@ func (l *regressionLayer) DimensionalLoss(index int, value float64) float64 {
 
 	// assume it is a struct with entries .dim and .val
 	// and we pass gradient only along dimension dim to be equal to val
-	var loss float64
 	dY := l.inVol.GetByIndex(index) - value
-	l.inVol.SetGradByIndex(index, dY)
-	loss += 0.5 * dY * dY
+	loss, grad := l.loss(index, dY)
+	l.inVol.SetGradByIndex(index, grad)
 	return loss
 }
 
+// loss returns the loss of the configured loss function and its gradient for
+// the difference between the prediction and the target of neuron i.
+func (l *regressionLayer) loss(i int, dY float64) (float64, float64) {
+	switch l.conf.Loss {
+	case AbsoluteLoss:
+		return math.Abs(dY), sign(dY)
+	case HuberLoss:
+		delta := l.conf.Delta
+		if math.Abs(dY) <= delta {
+			return 0.5 * dY * dY, dY
+		}
+		return delta * (math.Abs(dY) - 0.5*delta), delta * sign(dY)
+	case LogCoshLoss:
+		// log(cosh(x)) = |x| + log(1 + exp(-2|x|)) - log(2) does not overflow
+		a := math.Abs(dY)
+		return a + math.Log1p(math.Exp(-2*a)) - math.Ln2, math.Tanh(dY)
+	case QuantileLoss:
+		q := l.conf.Quantiles[0]
+		if len(l.conf.Quantiles) > 1 {
+			q = l.conf.Quantiles[i]
+		}
+
+		// under predictions cost q and over predictions cost 1-q
+		if dY < 0 {
+			return -q * dY, -q
+		}
+		return (1 - q) * dY, (1 - q) * sign(dY)
+	default:
+		return 0.5 * dY * dY, dY
+	}
+}
+
+// sign returns -1, 0 or 1 for the sign of x.
+func sign(x float64) float64 {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
 func (l *regressionLayer) Backward() {
 	panic(fmt.Errorf("Unsupported operation"))
 }
@@ -107,3 +226,9 @@ func (l *regressionLayer) Backward() {
 func (l *regressionLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *regressionLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
@@ -58,3 +58,17 @@ func (l *reluLayer) Backward() {
 func (*reluLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *reluLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
+
+func (l *reluLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	return l.Forward(b.Flat(), training).AsBatch(b.N(), b.Dimensions())
+}
+
+func (l *reluLayer) BackwardBatch() {
+	l.Backward()
+}
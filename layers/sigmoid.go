@@ -55,3 +55,17 @@ func (l *sigmoidLayer) Backward() {
 func (*sigmoidLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *sigmoidLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
+
+func (l *sigmoidLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	return l.Forward(b.Flat(), training).AsBatch(b.N(), b.Dimensions())
+}
+
+func (l *sigmoidLayer) BackwardBatch() {
+	l.Backward()
+}
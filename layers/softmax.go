@@ -35,6 +35,73 @@ func NewSoftmaxLayer(def LayerDef) Layer {
 	}
 }
 
+// WithClassWeights scales the loss of each sample by the weight of its class.
+// There must be one non-negative weight per class.
+func WithClassWeights(weights ...float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*softMaxLayerConfig)
+		if !ok {
+			return fmt.Errorf("invalid LayerConfig for softmax class weights")
+		} else if len(weights) != conf.Classes {
+			return fmt.Errorf("invalid class weight count: %d != %d", len(weights), conf.Classes)
+		}
+		for _, w := range weights {
+			if w < 0 {
+				return fmt.Errorf("class weights cannot be negative: %v", w)
+			}
+		}
+		conf.ClassWeights = weights
+		return nil
+	}
+}
+
+// WithFocalLoss uses the focal loss for the softmax layer, which scales the
+// loss of each class by (1 - p)^gamma so well classified samples contribute
+// less. A gamma of 0 is the ordinary cross entropy.
+func WithFocalLoss(gamma float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*softMaxLayerConfig)
+		if !ok {
+			return fmt.Errorf("invalid LayerConfig for softmax focal loss")
+		} else if gamma < 0 {
+			return fmt.Errorf("focal loss gamma cannot be negative: %v", gamma)
+		}
+		conf.Gamma = gamma
+		return nil
+	}
+}
+
+// WithLabelSmoothing trains the softmax layer against a target which puts
+// 1 - eps on the true class and spreads eps evenly over all classes.
+func WithLabelSmoothing(eps float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*softMaxLayerConfig)
+		if !ok {
+			return fmt.Errorf("invalid LayerConfig for softmax label smoothing")
+		} else if eps < 0 || eps >= 1 {
+			return fmt.Errorf("label smoothing must be in [0, 1): %v", eps)
+		}
+		conf.LabelSmoothing = eps
+		return nil
+	}
+}
+
+// WithTemperature sets the temperature used by LossDistribution. Higher
+// temperatures soften both the target and the output distribution, which is
+// used to distill the knowledge of a larger network into a smaller one.
+func WithTemperature(temperature float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*softMaxLayerConfig)
+		if !ok {
+			return fmt.Errorf("invalid LayerConfig for softmax temperature")
+		} else if temperature <= 0 {
+			return fmt.Errorf("temperature must be greater than 0: %v", temperature)
+		}
+		conf.Temperature = temperature
+		return nil
+	}
+}
+
 // NewSoftmaxLayerConfig creates a new LayerConfig config with the given options.
 func NewSoftmaxLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 	if classes <= 0 {
@@ -42,7 +109,8 @@ func NewSoftmaxLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 	}
 
 	conf := &softMaxLayerConfig{
-		Classes: classes,
+		Classes:     classes,
+		Temperature: 1.0,
 	}
 	for i := 0; i < len(opts); i++ {
 		err := opts[i](conf)
@@ -55,7 +123,11 @@ func NewSoftmaxLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 
 // softMaxLayerConfig stores the config info for softmax layers
 type softMaxLayerConfig struct {
-	Classes int
+	Classes        int
+	ClassWeights   []float64
+	Gamma          float64
+	LabelSmoothing float64
+	Temperature    float64
 }
 
 // GetSoftMaxPrediction returns the argmax prediction for the softmax layer.
@@ -87,6 +159,9 @@ type softmaxLayer struct {
 	outVol *volume.Volume
 
 	es []float64
+
+	// log of the softmax normalizer, used for the log probabilities
+	lse float64
 }
 
 func (l *softmaxLayer) Type() LayerType {
@@ -125,6 +200,7 @@ func (l *softmaxLayer) Forward(vol *volume.Volume, training bool) *volume.Volume
 
 	// save these for backprop
 	l.es = es
+	l.lse = aMax + math.Log(esum)
 	l.outVol = volA
 	return l.outVol
 }
@@ -134,22 +210,139 @@ func (l *softmaxLayer) Loss(index int) float64 {
 		panic(fmt.Errorf("Invalid dimension index: %d", index))
 	}
 
+	// target distribution, with label smoothing spreading part of the
+	// probability of the true class over every class
+	n := l.outDim.Z
+	eps := l.conf.LabelSmoothing
+	q := make([]float64, n)
+	for i := 0; i < n; i++ {
+		q[i] = eps / float64(n)
+		if i == index {
+			q[i] += 1 - eps
+		}
+	}
+
+	weight := 1.0
+	if l.conf.ClassWeights != nil {
+		weight = l.conf.ClassWeights[index]
+	}
+	return weight * l.crossEntropy(q, l.es, l.logProbabilities(1.0), weight)
+}
+
+// LossDistribution computes the cross entropy between the output and the
+// target distribution p, such as the output of a teacher network. When a
+// temperature is configured, both distributions are softened by it and the
+// loss is scaled by the squared temperature so that the gradients keep their
+// magnitude.
+func (l *softmaxLayer) LossDistribution(p []float64) float64 {
+	if len(p) != l.outDim.Size() {
+		panic(fmt.Errorf("Invalid input length: %d != %d", len(p), l.outDim.Size()))
+	}
+
+	var sum float64
+	for _, pi := range p {
+		if pi < 0 {
+			panic(fmt.Errorf("Invalid target probability: %v", pi))
+		}
+		sum += pi
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		panic(fmt.Errorf("Target probabilities must sum to 1: %v", sum))
+	}
+
+	T := l.conf.Temperature
+	if T == 1 {
+		return l.crossEntropy(p, l.es, l.logProbabilities(1.0), 1.0)
+	}
+
+	// softmax(log(p) / T) is the target softened by the temperature
+	n := l.outDim.Z
+	q := make([]float64, n)
+	var qsum float64
+	for i := 0; i < n; i++ {
+		q[i] = math.Pow(p[i], 1/T)
+		qsum += q[i]
+	}
+	for i := 0; i < n; i++ {
+		q[i] /= qsum
+	}
+
+	logp := l.logProbabilities(T)
+	soft := make([]float64, n)
+	for i := 0; i < n; i++ {
+		soft[i] = math.Exp(logp[i])
+	}
+
+	// the gradient of the scaled loss with respect to the input is
+	// T^2 * (soft - q) / T
+	return T * T * l.crossEntropy(q, soft, logp, T)
+}
+
+// logProbabilities returns the log of the softmax of the inputs divided by
+// the temperature.
+func (l *softmaxLayer) logProbabilities(temperature float64) []float64 {
+	n := l.outDim.Z
+	logp := make([]float64, n)
+	if temperature == 1 {
+		for i := 0; i < n; i++ {
+			logp[i] = l.inVol.GetByIndex(i) - l.lse
+		}
+		return logp
+	}
+
+	aMax := l.inVol.GetByIndex(0) / temperature
+	for i := 0; i < n; i++ {
+		aMax = math.Max(aMax, l.inVol.GetByIndex(i)/temperature)
+	}
+	var esum float64
+	for i := 0; i < n; i++ {
+		esum += math.Exp(l.inVol.GetByIndex(i)/temperature - aMax)
+	}
+	lse := aMax + math.Log(esum)
+	for i := 0; i < n; i++ {
+		logp[i] = l.inVol.GetByIndex(i)/temperature - lse
+	}
+	return logp
+}
+
+// crossEntropy computes the (focal) cross entropy between the target
+// distribution q and the output distribution p and writes its gradient,
+// scaled by scale, into the input volume.
+func (l *softmaxLayer) crossEntropy(q, p, logp []float64, scale float64) float64 {
 	// compute and accumulate gradient wrt weights and bias of this layer
 	// zero out the gradient of input Vol
 	l.inVol.ZeroGrad()
 
+	// For the loss L = -sum(q_i * (1-p_i)^gamma * log(p_i)), h_i is the
+	// derivative with respect to p_i multiplied by p_i. The gradient with
+	// respect to input j is then h_j - p_j * sum(h_i), which reduces to the
+	// familiar p_j - q_j when gamma is 0.
 	n := l.outDim.Z
+	gamma := l.conf.Gamma
+	h := make([]float64, n)
+	var loss, hsum float64
 	for i := 0; i < n; i++ {
-		indicator := 0.0
-		if i == index {
-			indicator = 1.0
+		if q[i] == 0 {
+			continue
+		}
+
+		focal, dfocal := 1.0, 0.0
+		if gamma > 0 {
+			focal = math.Pow(1-p[i], gamma)
+			if p[i] < 1 {
+				dfocal = gamma * math.Pow(1-p[i], gamma-1) * p[i] * logp[i]
+			}
 		}
 
-		l.inVol.SetGradByIndex(i, -(indicator - l.es[i]))
+		loss -= q[i] * focal * logp[i]
+		h[i] = -q[i] * (focal - dfocal)
+		hsum += h[i]
 	}
 
-	// loss is the class negative log likelihood
-	return -math.Log(l.es[index])
+	for i := 0; i < n; i++ {
+		l.inVol.SetGradByIndex(i, scale*(h[i]-p[i]*hsum))
+	}
+	return loss
 }
 
 func (l *softmaxLayer) Backward() {
@@ -159,3 +352,10 @@ func (l *softmaxLayer) Backward() {
 func (l *softmaxLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *softmaxLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	c.es = nil
+	return &c
+}
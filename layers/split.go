@@ -0,0 +1,124 @@
+package layers
+
+import (
+	"fmt"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// axisLength returns a pointer to the length of the dimensions along the axis.
+func axisLength(dim *volume.Dimensions, axis Axis) *int {
+	switch axis {
+	case AxisX:
+		return &dim.X
+	case AxisY:
+		return &dim.Y
+	default:
+		return &dim.Z
+	}
+}
+
+// NewSplitLayerConfig creates a new split config selecting size elements
+// along the axis, starting at offset.
+func NewSplitLayerConfig(axis Axis, offset, size int, opts ...LayerOptionFunc) LayerConfig {
+	if axis != AxisX && axis != AxisY && axis != AxisZ {
+		panic(fmt.Errorf("invalid split axis: %s", axis))
+	} else if offset < 0 {
+		panic("split offset cannot be negative")
+	} else if size <= 0 {
+		panic("split size must be greater than 0")
+	}
+
+	conf := &splitLayerConfig{
+		Axis:   axis,
+		Offset: offset,
+		Size:   size,
+	}
+	for i := 0; i < len(opts); i++ {
+		err := opts[i](conf)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return conf
+}
+
+// splitLayerConfig stores the config info for split layers
+type splitLayerConfig struct {
+	Axis   Axis
+	Offset int
+	Size   int
+}
+
+// NewSplitLayer creates a new split layer. A split layer passes on a
+// contiguous range of its input along one axis. A volume is separated into
+// several parts by feeding it to one split layer per part.
+func NewSplitLayer(def LayerDef) Layer {
+	if def.Type != Split {
+		panic(fmt.Errorf("Invalid layer type: %s != split", def.Type))
+	} else if def.Output.Z == 0 {
+		panic(fmt.Errorf("Output depth cannot be 0 for split layer"))
+	}
+
+	// Get config
+	conf, ok := def.LayerConfig.(*splitLayerConfig)
+	if !ok {
+		panic("Invalid LayerConfig for SplitLayer")
+	}
+
+	var offset volume.Dimensions
+	*axisLength(&offset, conf.Axis) = conf.Offset
+	return &splitLayer{conf, offset, def.Output, nil, nil}
+}
+
+type splitLayer struct {
+	conf   *splitLayerConfig
+	offset volume.Dimensions
+	output volume.Dimensions
+
+	inVol  *volume.Volume
+	outVol *volume.Volume
+}
+
+func (*splitLayer) Type() LayerType {
+	return Split
+}
+
+func (l *splitLayer) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	l.inVol = vol
+	A := volume.NewVolume(l.output, volume.WithZeros())
+
+	for x := 0; x < l.output.X; x++ {
+		for y := 0; y < l.output.Y; y++ {
+			for d := 0; d < l.output.Z; d++ {
+				A.Set(x, y, d, vol.Get(l.offset.X+x, l.offset.Y+y, l.offset.Z+d))
+			}
+		}
+	}
+
+	l.outVol = A
+	return l.outVol
+}
+
+func (l *splitLayer) Backward() {
+	// elements outside of the range receive no gradient
+	l.inVol.ZeroGrad()
+
+	for x := 0; x < l.output.X; x++ {
+		for y := 0; y < l.output.Y; y++ {
+			for d := 0; d < l.output.Z; d++ {
+				l.inVol.SetGrad(l.offset.X+x, l.offset.Y+y, l.offset.Z+d, l.outVol.GetGrad(x, y, d))
+			}
+		}
+	}
+}
+
+func (*splitLayer) GetResponse() []LayerResponse {
+	return []LayerResponse{}
+}
+
+func (l *splitLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
@@ -22,6 +22,47 @@ func NewSVMLayer(def LayerDef) Layer {
 	return &svmLayer{conf, def.Input, volume.Dimensions{X: 1, Y: 1, Z: n}, nil, nil}
 }
 
+// WithMargin sets the margin by which the score of the true class must
+// exceed the other scores for the svm layer
+func WithMargin(margin float64) LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*svmLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for SVMLayer margin")
+		} else if margin <= 0 {
+			return fmt.Errorf("SVM margin must be greater than 0: %v", margin)
+		}
+		conf.Margin = margin
+		return nil
+	}
+}
+
+// WithSquaredHinge uses the squared hinge loss (L2-SVM) for the svm layer
+func WithSquaredHinge() LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*svmLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for SVMLayer squared hinge")
+		}
+		conf.SquaredHinge = true
+		return nil
+	}
+}
+
+// WithOneVsRest trains the svm layer as one binary classifier per class
+// instead of the multiclass (Crammer-Singer) formulation. Each score must
+// exceed the margin for the true class and stay below -margin otherwise.
+func WithOneVsRest() LayerOptionFunc {
+	return func(lc LayerConfig) error {
+		conf, ok := lc.(*svmLayerConfig)
+		if !ok {
+			return fmt.Errorf("Invalid LayerConfig for SVMLayer one-vs-rest")
+		}
+		conf.OneVsRest = true
+		return nil
+	}
+}
+
 // NewSVMLayerConfig creates a new LayerConfig config with the given options.
 func NewSVMLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 	if classes <= 0 {
@@ -30,6 +71,7 @@ func NewSVMLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 
 	conf := &svmLayerConfig{
 		Classes: classes,
+		Margin:  1.0,
 	}
 	for i := 0; i < len(opts); i++ {
 		err := opts[i](conf)
@@ -42,7 +84,10 @@ func NewSVMLayerConfig(classes int, opts ...LayerOptionFunc) LayerConfig {
 
 // svmLayerConfig stores the config info for svm layers
 type svmLayerConfig struct {
-	Classes int
+	Classes      int
+	Margin       float64
+	SquaredHinge bool
+	OneVsRest    bool
 }
 
 type svmLayer struct {
@@ -73,6 +118,10 @@ func (l *svmLayer) Loss(index int) float64 {
 	// zero out the gradient of input Vol
 	l.inVol.ZeroGrad()
 
+	if l.conf.OneVsRest {
+		return l.oneVsRestLoss(index)
+	}
+
 	// score of ground truth
 	yScore := l.inVol.GetByIndex(index)
 
@@ -81,7 +130,7 @@ func (l *svmLayer) Loss(index int) float64 {
 	// class, by a margin
 
 	var loss float64
-	margin := 1.0
+	margin := l.conf.Margin
 	for i := 0; i < l.outVol.Size(); i++ {
 		if index == i {
 			continue
@@ -90,14 +139,43 @@ func (l *svmLayer) Loss(index int) float64 {
 		yDiff := -yScore + l.inVol.GetByIndex(i) + margin
 		if yDiff > 0 {
 			// violating dimension, apply loss
-			l.inVol.AddGradByIndex(i, 1.0)
-			l.inVol.AddGradByIndex(index, -1.0)
-			loss += yDiff
+			li, grad := l.hinge(yDiff)
+			l.inVol.AddGradByIndex(i, grad)
+			l.inVol.AddGradByIndex(index, -grad)
+			loss += li
 		}
 	}
 	return loss
 }
 
+// oneVsRestLoss computes the sum of the binary hinge losses of every class,
+// where only the class at index is positive.
+func (l *svmLayer) oneVsRestLoss(index int) float64 {
+	var loss float64
+	for i := 0; i < l.outVol.Size(); i++ {
+		label := -1.0
+		if i == index {
+			label = 1.0
+		}
+
+		yDiff := l.conf.Margin - label*l.inVol.GetByIndex(i)
+		if yDiff > 0 {
+			li, grad := l.hinge(yDiff)
+			l.inVol.AddGradByIndex(i, -label*grad)
+			loss += li
+		}
+	}
+	return loss
+}
+
+// hinge returns the loss and its gradient for a positive margin violation.
+func (l *svmLayer) hinge(violation float64) (float64, float64) {
+	if l.conf.SquaredHinge {
+		return violation * violation, 2 * violation
+	}
+	return violation, 1.0
+}
+
 func (l *svmLayer) Backward() {
 	panic(fmt.Errorf("Unsupported operation"))
 }
@@ -105,3 +183,9 @@ func (l *svmLayer) Backward() {
 func (l *svmLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *svmLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
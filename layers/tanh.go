@@ -51,3 +51,17 @@ func (l *tanhLayer) Backward() {
 func (*tanhLayer) GetResponse() []LayerResponse {
 	return []LayerResponse{}
 }
+
+func (l *tanhLayer) Clone() Layer {
+	c := *l
+	c.inVol, c.outVol = nil, nil
+	return &c
+}
+
+func (l *tanhLayer) ForwardBatch(b *volume.Batch, training bool) *volume.Batch {
+	return l.Forward(b.Flat(), training).AsBatch(b.N(), b.Dimensions())
+}
+
+func (l *tanhLayer) BackwardBatch() {
+	l.Backward()
+}
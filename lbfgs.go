@@ -0,0 +1,217 @@
+package reticulum
+
+import (
+	"math"
+	"time"
+
+	"github.com/eliquious/reticulum/layers"
+)
+
+// lbfgs keeps the curvature history of the L-BFGS optimizer.
+type lbfgs struct {
+	// parameter and gradient differences of the last updates, oldest first
+	s, y [][]float64
+	rho  []float64
+}
+
+// direction computes the search direction -H * grad with the two-loop
+// recursion over the history.
+func (h *lbfgs) direction(grad []float64) []float64 {
+	d := make([]float64, len(grad))
+	for j, g := range grad {
+		d[j] = -g
+	}
+
+	alpha := make([]float64, len(h.s))
+	for i := len(h.s) - 1; i >= 0; i-- {
+		alpha[i] = h.rho[i] * dot(h.s[i], d)
+		axpy(-alpha[i], h.y[i], d)
+	}
+
+	// scale by the curvature of the latest update
+	if n := len(h.s); n > 0 {
+		gamma := dot(h.s[n-1], h.y[n-1]) / dot(h.y[n-1], h.y[n-1])
+		for j := range d {
+			d[j] *= gamma
+		}
+	}
+
+	for i := range h.s {
+		beta := h.rho[i] * dot(h.y[i], d)
+		axpy(alpha[i]-beta, h.s[i], d)
+	}
+	return d
+}
+
+// update adds a step to the history. Steps without positive curvature are
+// skipped to keep the inverse Hessian approximation positive definite.
+func (h *lbfgs) update(s, y []float64, memory int) {
+	sy := dot(s, y)
+	if sy <= 1e-10 {
+		return
+	}
+	h.s = append(h.s, s)
+	h.y = append(h.y, y)
+	h.rho = append(h.rho, 1/sy)
+	if len(h.s) > memory {
+		h.s, h.y, h.rho = h.s[1:], h.y[1:], h.rho[1:]
+	}
+}
+
+func (h *lbfgs) reset() {
+	h.s, h.y, h.rho = nil, nil, nil
+}
+
+// TrainFullBatch performs one L-BFGS iteration with a backtracking line search
+// on the mean loss over the whole data set, including the weight decay. Each
+// sample is trained on the first head of the network. The options of the
+// optimizer, batch size and gradient clipping do not apply. The learning rate
+// of the results is the accepted step length.
+func (t *trainer) TrainFullBatch(data Dataset) TrainingResults {
+	if data.Len() == 0 {
+		panic("full batch training requires a non-empty data set")
+	}
+	if t.lbfgs == nil {
+		t.lbfgs = &lbfgs{}
+	}
+
+	var res TrainingResults
+	resp := t.net.GetResponse()
+	x := flattenParams(resp)
+	grad := make([]float64, len(x))
+	f := t.fullBatchLoss(data, resp, grad, &res)
+
+	// restart from steepest descent if the direction is not a descent direction
+	d := t.lbfgs.direction(grad)
+	slope := dot(grad, d)
+	if slope >= 0 {
+		t.lbfgs.reset()
+		d = t.lbfgs.direction(grad)
+		slope = dot(grad, d)
+	}
+
+	// the first step is scaled to the size of the gradient
+	step := 1.0
+	if len(t.lbfgs.s) == 0 {
+		step = math.Min(1, 1/math.Sqrt(dot(grad, grad)))
+	}
+
+	// backtrack until the Armijo condition holds
+	const c1 = 1e-4
+	next := make([]float64, len(x))
+	nextGrad := make([]float64, len(x))
+	nextF := f
+	for i := 0; i < 30; i++ {
+		for j := range x {
+			next[j] = x[j] + step*d[j]
+		}
+		setParams(resp, next)
+		nextF = t.fullBatchLoss(data, resp, nextGrad, &res)
+		if nextF <= f+c1*step*slope {
+			break
+		}
+		step /= 2
+	}
+
+	if nextF > f {
+		// no progress along the direction, keep the parameters and start over
+		setParams(resp, x)
+		t.lbfgs.reset()
+		t.fullBatchLoss(data, resp, grad, &res)
+		step = 0
+	} else {
+		s := make([]float64, len(x))
+		y := make([]float64, len(x))
+		for j := range x {
+			s[j] = next[j] - x[j]
+			y[j] = nextGrad[j] - grad[j]
+		}
+		t.lbfgs.update(s, y, t.opts.Memory)
+	}
+
+	res.TotalLoss = res.CostLost + res.L1DecayLoss + res.L2DecayLoss
+	res.LearningRate = step
+	for _, cb := range t.opts.Callbacks {
+		cb.OnBatchEnd(t.net, res)
+	}
+	return res
+}
+
+// fullBatchLoss computes the mean loss of the data set at the current
+// parameters and writes its gradient, including the weight decay, to grad.
+// The results hold the losses of the evaluation and accumulate the time spent.
+func (t *trainer) fullBatchLoss(data Dataset, resp []layers.LayerResponse, grad []float64, res *TrainingResults) float64 {
+	for _, pg := range resp {
+		for j := range pg.Gradients {
+			pg.Gradients[j] = 0
+		}
+	}
+
+	var cost float64
+	for i := 0; i < data.Len(); i++ {
+		vol, target := data.Get(i)
+		start := time.Now()
+		t.net.Forward(vol, false)
+		res.ForwardTime += time.Now().Sub(start)
+
+		start = time.Now()
+		cost += TargetLossFunc(target)(t.net)
+		res.BackwardTime += time.Now().Sub(start)
+	}
+
+	n := float64(data.Len())
+	var l1DecayLoss, l2DecayLoss float64
+	var k int
+	for _, pg := range resp {
+		l1Decay := t.opts.L1Decay * pg.L1DecayMul
+		l2Decay := t.opts.L2Decay * pg.L2DecayMul
+		for j, p := range pg.Weights {
+			l2DecayLoss += l2Decay * p * p / 2.0
+			l1DecayLoss += l1Decay * math.Abs(p)
+			l1Grad, l2Grad := l1Decay, l2Decay*p
+			if p <= 0 {
+				l1Grad *= -1
+			}
+			grad[k] = pg.Gradients[j]/n + l1Grad + l2Grad
+			pg.Gradients[j] = 0
+			k++
+		}
+	}
+
+	res.CostLost = cost / n
+	res.L1DecayLoss = l1DecayLoss
+	res.L2DecayLoss = l2DecayLoss
+	return res.CostLost + l1DecayLoss + l2DecayLoss
+}
+
+// flattenParams copies all parameters into a single slice.
+func flattenParams(resp []layers.LayerResponse) []float64 {
+	var x []float64
+	for _, pg := range resp {
+		x = append(x, pg.Weights...)
+	}
+	return x
+}
+
+// setParams copies the flattened parameters back into the network.
+func setParams(resp []layers.LayerResponse, x []float64) {
+	var k int
+	for _, pg := range resp {
+		k += copy(pg.Weights, x[k:])
+	}
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for j := range a {
+		sum += a[j] * b[j]
+	}
+	return sum
+}
+
+// axpy computes y += a * x.
+func axpy(a float64, x, y []float64) {
+	for j := range x {
+		y[j] += a * x[j]
+	}
+}
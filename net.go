@@ -2,6 +2,7 @@ package reticulum
 
 import (
 	"errors"
+	"fmt"
 
 	layers "github.com/eliquious/reticulum/layers"
 	volume "github.com/eliquious/reticulum/volume"
@@ -18,15 +19,137 @@ type Network interface {
 	Layers() []layers.Layer
 
 	Forward(vol *volume.Volume, training bool) *volume.Volume
+
+	// ForwardInputs feeds every named input of the network. Unnamed inputs
+	// use the empty string as their name.
+	ForwardInputs(inputs map[string]*volume.Volume, training bool) (*volume.Volume, error)
 	Backward(index int) float64
 	GetCostLoss(vol *volume.Volume, index int) float64
 
 	// GetPrediction assumes the last layer in the network is a SoftMax layer.
 	GetPrediction() int
+
+	// Predict runs the network on the input and returns the scores of every
+	// class. An error is returned if the network does not end in a softmax,
+	// svm or multi-label layer.
+	Predict(vol *volume.Volume) (*Prediction, error)
 	GetResponse() []layers.LayerResponse
 
 	MultiDimensionalLoss(losses []float64) float64
 	DimensionalLoss(index int, value float64) float64
+
+	// Inputs returns the names of the inputs of the network.
+	Inputs() []string
+
+	// Heads returns the names of the output layers of the network.
+	Heads() []string
+
+	// BackwardHeads computes the loss of every given head and runs a single
+	// backward pass with the gradients scaled by the head weights. The
+	// weighted sum of the losses is returned. Each head may only be given
+	// once.
+	BackwardHeads(heads ...HeadLoss) float64
+
+	// HeadLosses returns the unweighted loss of each head from the last call
+	// to BackwardHeads, or nil if it has not been called since Forward.
+	HeadLosses() map[string]float64
+
+	// Output returns the volume produced by the last forward pass.
+	Output() *volume.Volume
+
+	// BackwardOutput propagates the gradient stored in the output volume
+	// through every layer of the network, including the last one. It is
+	// used for networks which end without a loss layer.
+	BackwardOutput()
+
+	// Clone returns a copy of the network which can run in another
+	// goroutine. The copy shares the weights of the network and accumulates
+	// its own gradients, which GetResponse reports in the same order. The
+	// weights must not be updated while a copy is running.
+	Clone() Network
+}
+
+// BatchNetwork is implemented by networks which can run a mini-batch through
+// their layers in one pass. Every layer except the final loss layer must be a
+// layers.BatchLayer. Fully connected, dropout and activation layers process
+// the batch as a whole. Convolution and pool layers loop over its samples,
+// and the loss layer runs each sample through a clone of its own. Maxout,
+// merge and split layers have no batch path, and graph networks are not
+// BatchNetworks.
+type BatchNetwork interface {
+	Network
+
+	// ForwardBatch runs the batch through the network and returns the
+	// output of every sample. An error is returned if the dimensions of the
+	// batch don't match the input of the network or a layer does not
+	// support batches.
+	ForwardBatch(b *volume.Batch, training bool) (*volume.Batch, error)
+
+	// BackwardBatch computes the loss of every sample of the last batch
+	// against its target and accumulates the gradients of the whole batch
+	// in one backward pass. The sum of the losses is returned.
+	BackwardBatch(targets []Target) float64
+}
+
+// Target is the expected output of a loss layer. Label is used by
+// classification layers and Values by regression and multi-label layers.
+// Softmax layers accept either a Label or a probability distribution in Values.
+type Target struct {
+	Label  int
+	Values []float64
+}
+
+// HeadLoss is the target for a single head of the network and the weight of
+// its loss in the total loss.
+type HeadLoss struct {
+	Head   string
+	Weight float64
+	Target Target
+}
+
+// targetLoss computes the loss of the layer for the target and writes the
+// gradient of the loss into the input of the layer.
+func targetLoss(layer layers.Layer, t Target) float64 {
+	if t.Values != nil {
+		switch lossLayer := layer.(type) {
+		case layers.RegressionLossLayer:
+			return lossLayer.MultiDimensionalLoss(t.Values)
+		case layers.MultiLabelLossLayer:
+			return lossLayer.Loss(t.Values)
+		case layers.DistributionLossLayer:
+			return lossLayer.LossDistribution(t.Values)
+		}
+		panic(fmt.Errorf("%s layer does not accept target values", layer.Type()))
+	}
+
+	if lossLayer, ok := layer.(layers.LossLayer); ok {
+		return lossLayer.Loss(t.Label)
+	}
+	panic(fmt.Errorf("%s layer does not accept a target label", layer.Type()))
+}
+
+// acceptsTarget reports whether targetLoss can compute the loss of the layer
+// for the target.
+func acceptsTarget(layer layers.Layer, t Target) bool {
+	if t.Values == nil {
+		_, ok := layer.(layers.LossLayer)
+		return ok
+	}
+	switch layer.(type) {
+	case layers.RegressionLossLayer, layers.MultiLabelLossLayer, layers.DistributionLossLayer:
+		return true
+	}
+	return false
+}
+
+// headLoss computes the loss of the head and scales the gradient written
+// into in, the input of the loss layer, by the weight of the head.
+func headLoss(layer layers.Layer, in *volume.Volume, h HeadLoss) float64 {
+	loss := targetLoss(layer, h.Target)
+	for i := 0; i < in.Size(); i++ {
+		in.SetGradByIndex(i, in.GetGradByIndex(i)*h.Weight)
+	}
+	return loss
 }
 
 // NewNetwork creates a new network from the layer definitions
@@ -47,41 +170,141 @@ func NewNetwork(defs []layers.LayerDef) (Network, error) {
 			def.Input = prev.Output
 		}
 
-		switch def.Type {
-		case layers.FullyConnected:
-			newLayers = append(newLayers, layers.NewFullyConnectedLayer(def))
-		case layers.Dropout:
-			newLayers = append(newLayers, layers.NewDropoutLayer(def))
-		case layers.Input:
-			newLayers = append(newLayers, layers.NewInputLayer(def))
-		case layers.SoftMax:
-			newLayers = append(newLayers, layers.NewSoftmaxLayer(def))
-		case layers.Regression:
-			newLayers = append(newLayers, layers.NewRegressionLayer(def))
-		case layers.Conv:
-			newLayers = append(newLayers, layers.NewConvLayer(def))
-		case layers.Pool:
-			newLayers = append(newLayers, layers.NewPoolLayer(def))
-		case layers.ReLU:
-			newLayers = append(newLayers, layers.NewReluLayer(def))
-		case layers.Sigmoid:
-			newLayers = append(newLayers, layers.NewSigmoidLayer(def))
-		case layers.Tanh:
-			newLayers = append(newLayers, layers.NewTanhLayer(def))
-		case layers.Maxout:
-			newLayers = append(newLayers, layers.NewMaxoutLayer(def))
-		case layers.SVM:
-			newLayers = append(newLayers, layers.NewSVMLayer(def))
-		// case layers.LocalResponseNorm:
-		default:
-			return nil, errors.New("unrecognized layer type")
+		layer, err := newLayer(&def)
+		if err != nil {
+			return nil, err
 		}
+		defs[i] = def
+		newLayers = append(newLayers, layer)
+	}
+	if err := shareWeights(defs, newLayers); err != nil {
+		return nil, err
+	}
+	return &network{layers: newLayers, defs: defs, input: defs[0].Name, output: defs[len(defs)-1].Name}, nil
+}
+
+// shareWeights links the layers whose definitions share the weights of
+// another named layer. Chains of layers sharing weights are followed to the
+// layer which owns the weights.
+func shareWeights(defs []layers.LayerDef, built []layers.Layer) error {
+	named := make(map[string]int)
+	for i, def := range defs {
+		if def.Name == "" {
+			continue
+		} else if _, ok := named[def.Name]; ok {
+			return fmt.Errorf("duplicate layer name: %s", def.Name)
+		}
+		named[def.Name] = i
+	}
+
+	for i, def := range defs {
+		if def.ShareWeightsWith == "" {
+			continue
+		}
+
+		owner := i
+		visited := map[int]bool{i: true}
+		for defs[owner].ShareWeightsWith != "" {
+			j, ok := named[defs[owner].ShareWeightsWith]
+			if !ok {
+				return fmt.Errorf("unknown layer to share weights with: %s", defs[owner].ShareWeightsWith)
+			} else if visited[j] {
+				return fmt.Errorf("layer %s cannot share weights with itself", def.Name)
+			}
+			visited[j] = true
+			owner = j
+		}
+		if err := layers.ShareWeights(built[i], built[owner]); err != nil {
+			return fmt.Errorf("layer %s: %v", def.Name, err)
+		}
+	}
+	return nil
+}
+
+// cloneLayers clones the layers and links the weights of the clones which
+// share the weights of another layer.
+func cloneLayers(defs []layers.LayerDef, l []layers.Layer) []layers.Layer {
+	clones := make([]layers.Layer, len(l))
+	for i, layer := range l {
+		clones[i] = layer.Clone()
+	}
+	if err := shareWeights(defs, clones); err != nil {
+		// the definitions were validated when the network was created
+		panic(err)
+	}
+	return clones
+}
+
+// newLayer infers the output dimensions of the definition and creates the layer.
+func newLayer(def *layers.LayerDef) (layers.Layer, error) {
+	out, err := layers.OutputDimensions(*def)
+	if err != nil {
+		return nil, err
+	}
+	def.Output = out
+
+	switch def.Type {
+	case layers.FullyConnected:
+		return layers.NewFullyConnectedLayer(*def), nil
+	case layers.Dropout:
+		return layers.NewDropoutLayer(*def), nil
+	case layers.Input:
+		return layers.NewInputLayer(*def), nil
+	case layers.SoftMax:
+		return layers.NewSoftmaxLayer(*def), nil
+	case layers.Regression:
+		return layers.NewRegressionLayer(*def), nil
+	case layers.Conv:
+		return layers.NewConvLayer(*def), nil
+	case layers.Pool:
+		return layers.NewPoolLayer(*def), nil
+	case layers.ReLU:
+		return layers.NewReluLayer(*def), nil
+	case layers.Sigmoid:
+		return layers.NewSigmoidLayer(*def), nil
+	case layers.Tanh:
+		return layers.NewTanhLayer(*def), nil
+	case layers.Maxout:
+		return layers.NewMaxoutLayer(*def), nil
+	case layers.SVM:
+		return layers.NewSVMLayer(*def), nil
+	case layers.Add:
+		return layers.NewAddLayer(*def), nil
+	case layers.Multiply:
+		return layers.NewMultiplyLayer(*def), nil
+	case layers.Concat:
+		return layers.NewConcatLayer(*def), nil
+	case layers.Split:
+		return layers.NewSplitLayer(*def), nil
+	case layers.MultiLabel:
+		return layers.NewMultiLabelLayer(*def), nil
+	// case layers.LocalResponseNorm:
+	default:
+		return nil, errors.New("unrecognized layer type")
 	}
-	return &network{newLayers}, nil
 }
 
 type network struct {
 	layers []layers.Layer
+
+	// definitions of the layers, used to share weights between clones
+	defs []layers.LayerDef
+
+	// names of the input and output layers
+	input  string
+	output string
+
+	// input of the loss layer and output from the last forward pass
+	lossIn *volume.Volume
+	outVol *volume.Volume
+
+	// unweighted loss from the last call to BackwardHeads
+	headLosses map[string]float64
+
+	// input of the loss layer from the last call to ForwardBatch and the
+	// clones of the loss layer which ran each of its samples
+	batchIn   *volume.Batch
+	batchLoss []layers.Layer
 }
 
 func (n *network) Size() int {
@@ -93,13 +316,26 @@ func (n *network) Layers() []layers.Layer {
 }
 
 func (n *network) Forward(vol *volume.Volume, training bool) *volume.Volume {
+	n.headLosses = nil
 	actions := n.layers[0].Forward(vol, training)
 	for index := 1; index < len(n.layers); index++ {
-		actions = n.layers[index].Forward(vol, training)
+		n.lossIn = actions
+		actions = n.layers[index].Forward(actions, training)
 	}
+	n.outVol = actions
 	return actions
 }
 
+func (n *network) ForwardInputs(inputs map[string]*volume.Volume, training bool) (*volume.Volume, error) {
+	vol, ok := inputs[n.input]
+	if !ok || len(inputs) != 1 {
+		return nil, fmt.Errorf("network expects a single input named %q", n.input)
+	} else if dim := n.defs[0].Output; vol.Dimensions() != dim {
+		return nil, fmt.Errorf("invalid dimensions for input %s: %v != %v", n.input, vol.Dimensions(), dim)
+	}
+	return n.Forward(vol, training), nil
+}
+
 func (n *network) Backward(index int) float64 {
 	size := n.Size()
 
@@ -111,9 +347,7 @@ func (n *network) Backward(index int) float64 {
 	loss := lossLayer.Loss(index)
 
 	// Propogate backwards
-	for index := n.Size() - 2; index >= 0; index-- {
-		n.layers[index].Backward()
-	}
+	n.propagate()
 	return loss
 }
 
@@ -138,6 +372,11 @@ func (n *network) GetPrediction() int {
 	return layers.GetSoftMaxPrediction(S)
 }
 
+func (n *network) Predict(vol *volume.Volume) (*Prediction, error) {
+	out := n.Forward(vol, false)
+	return newPrediction(n.layers[n.Size()-1], out)
+}
+
 func (n *network) GetResponse() []layers.LayerResponse {
 	// accumulate parameters and gradients for the entire network
 	resp := []layers.LayerResponse{}
@@ -154,7 +393,9 @@ func (n *network) MultiDimensionalLoss(y []float64) float64 {
 	if !ok {
 		panic("MultiDimensionalLoss assumes a Regression layer is the last layer in the network")
 	}
-	return lossLayer.MultiDimensionalLoss(y)
+	loss := lossLayer.MultiDimensionalLoss(y)
+	n.propagate()
+	return loss
 }
 
 func (n *network) DimensionalLoss(index int, value float64) float64 {
@@ -162,5 +403,100 @@ func (n *network) DimensionalLoss(index int, value float64) float64 {
 	if !ok {
 		panic("DimensionalLoss assumes a Regression layer is the last layer in the network")
 	}
-	return lossLayer.DimensionalLoss(index, value)
+	loss := lossLayer.DimensionalLoss(index, value)
+	n.propagate()
+	return loss
+}
+
+// propagate runs the backward pass from the layer before the loss layer.
+func (n *network) propagate() {
+	for index := n.Size() - 2; index >= 0; index-- {
+		n.layers[index].Backward()
+	}
+}
+
+func (n *network) Inputs() []string {
+	return []string{n.input}
+}
+
+func (n *network) Heads() []string {
+	return []string{n.output}
+}
+
+func (n *network) BackwardHeads(heads ...HeadLoss) float64 {
+	if len(heads) != 1 || heads[0].Head != n.output {
+		panic(fmt.Errorf("network expects a single head named %q", n.output))
+	}
+
+	h := heads[0]
+	loss := headLoss(n.layers[n.Size()-1], n.lossIn, h)
+	n.propagate()
+	n.headLosses = map[string]float64{h.Head: loss}
+	return h.Weight * loss
+}
+
+func (n *network) HeadLosses() map[string]float64 {
+	return n.headLosses
+}
+
+func (n *network) Output() *volume.Volume {
+	return n.outVol
+}
+
+func (n *network) BackwardOutput() {
+	for index := n.Size() - 1; index >= 0; index-- {
+		n.layers[index].Backward()
+	}
+}
+
+func (n *network) ForwardBatch(b *volume.Batch, training bool) (*volume.Batch, error) {
+	n.batchIn = nil
+	if dim := n.defs[0].Output; b.Dimensions() != dim {
+		return nil, fmt.Errorf("invalid dimensions for batch: %v != %v", b.Dimensions(), dim)
+	}
+	last := n.Size() - 1
+	for index := 0; index < last; index++ {
+		layer, ok := n.layers[index].(layers.BatchLayer)
+		if !ok {
+			return nil, fmt.Errorf("%s layer does not support batches", n.layers[index].Type())
+		}
+		b = layer.ForwardBatch(b, training)
+	}
+	n.batchIn = b
+
+	// the loss layer only keeps its last sample, so each sample runs through
+	// a clone which keeps it for BackwardBatch
+	for len(n.batchLoss) < b.N() {
+		n.batchLoss = append(n.batchLoss, n.layers[last].Clone())
+	}
+	var out *volume.Batch
+	for i := 0; i < b.N(); i++ {
+		vol := n.batchLoss[i].Forward(b.At(i), training)
+		if out == nil {
+			out = volume.NewBatch(b.N(), vol.Dimensions())
+		}
+		copy(out.At(i).Weights(), vol.Weights())
+	}
+	return out, nil
+}
+
+func (n *network) BackwardBatch(targets []Target) float64 {
+	if n.batchIn == nil || len(targets) != n.batchIn.N() {
+		panic("BackwardBatch expects a target for every sample of the last batch")
+	}
+
+	// the loss of each sample writes its gradient into the batch
+	var loss float64
+	for i, t := range targets {
+		loss += targetLoss(n.batchLoss[i], t)
+	}
+
+	for index := n.Size() - 2; index >= 0; index-- {
+		n.layers[index].(layers.BatchLayer).BackwardBatch()
+	}
+	return loss
+}
+
+func (n *network) Clone() Network {
+	return &network{layers: cloneLayers(n.defs, n.layers), defs: n.defs, input: n.input, output: n.output}
 }
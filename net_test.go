@@ -0,0 +1,252 @@
+package reticulum
+
+import (
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestOutputLossFunc(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// absolute error to the target, written as a custom loss
+	y := []float64{0.2, -0.4}
+	loss := func(out *volume.Volume) float64 {
+		var cost float64
+		for i := 0; i < out.Size(); i++ {
+			d := out.GetByIndex(i) - y[i]
+			if d < 0 {
+				cost -= d
+				out.SetGradByIndex(i, -1)
+			} else {
+				cost += d
+				out.SetGradByIndex(i, 1)
+			}
+		}
+		return cost
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	checkLossGradients(t, net, x, func() { OutputLossFunc(loss)(net) }, func() float64 { return loss(net.Output()) })
+}
+
+func TestNetwork_Predict(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    layers.LayerDef
+		wantErr bool
+	}{
+		{"softmax", layers.LayerDef{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(6)}, false},
+		{"svm", layers.LayerDef{Type: layers.SVM, LayerConfig: layers.NewSVMLayerConfig(6)}, false},
+		{"regression", layers.LayerDef{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(6)}, true},
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			net, err := NewNetwork([]layers.LayerDef{
+				{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+				{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+				tt.head,
+			})
+			if err != nil {
+				t.Fatalf("NewNetwork() error = %v", err)
+			}
+
+			p, err := net.Predict(x)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Predict() error = %v, wantErr %v", err, tt.wantErr)
+			} else if err != nil {
+				return
+			}
+
+			top := p.Top(5)
+			if len(top) != 5 || top[0].Class != p.Class {
+				t.Fatalf("Top(5) = %v, want 5 classes starting with %d", top, p.Class)
+			}
+			for i := 1; i < len(top); i++ {
+				if top[i].Score > top[i-1].Score {
+					t.Errorf("Top(5) = %v, want descending scores", top)
+				}
+			}
+
+			// the result does not share the ranking of the prediction
+			first := p.Ranked[0]
+			top[0].Score = -1
+			_ = append(p.Top(2), ClassScore{Class: -1})
+			if p.Ranked[0] != first || p.Ranked[2].Class == -1 {
+				t.Errorf("Ranked = %v after changing the result of Top, want it unchanged", p.Ranked)
+			}
+			if got := len(p.Top(10)); got != 6 {
+				t.Errorf("len(Top(10)) = %d, want 6", got)
+			}
+			if got := len(p.Top(-1)); got != 0 {
+				t.Errorf("len(Top(-1)) = %d, want 0", got)
+			}
+			if (p.Probabilities != nil) != (tt.name == "softmax") {
+				t.Errorf("Probabilities = %v", p.Probabilities)
+			}
+		})
+	}
+}
+
+func TestNetwork_Forward(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// every layer runs on the output of the layer before it
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	want := x
+	for _, layer := range net.Layers() {
+		want = layer.Forward(want, false)
+	}
+	got := net.Forward(x, false)
+	if got.Size() != 2 {
+		t.Fatalf("Forward() size = %d, want 2", got.Size())
+	}
+	for i := 0; i < got.Size(); i++ {
+		if got.GetByIndex(i) != want.GetByIndex(i) {
+			t.Errorf("Forward()[%d] = %v, want %v", i, got.GetByIndex(i), want.GetByIndex(i))
+		}
+	}
+}
+
+func TestNetwork_MultiDimensionalLoss(t *testing.T) {
+	y := []float64{0.2, -0.4}
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	losses := map[string]func(net Network) float64{
+		"multi": func(net Network) float64 { return net.MultiDimensionalLoss(y) },
+		"dimension": func(net Network) float64 {
+			return net.DimensionalLoss(0, y[0]) + net.DimensionalLoss(1, y[1])
+		},
+	}
+	for name, loss := range losses {
+		t.Run(name, func(t *testing.T) {
+			net, err := NewNetwork([]layers.LayerDef{
+				{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+				{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+				{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)},
+			})
+			if err != nil {
+				t.Fatalf("NewNetwork() error = %v", err)
+			}
+
+			// the loss is propagated into the parameters of every layer
+			net.Forward(x, true)
+			loss(net)
+			var grads [][]float64
+			for _, pg := range net.GetResponse() {
+				grads = append(grads, append([]float64(nil), pg.Gradients...))
+			}
+
+			const h = 1e-5
+			for i, pg := range net.GetResponse() {
+				for j := range pg.Weights {
+					want := pg.Weights[j]
+					pg.Weights[j] = want + h
+					net.Forward(x, false)
+					lp := loss(net)
+					pg.Weights[j] = want - h
+					net.Forward(x, false)
+					lm := loss(net)
+					pg.Weights[j] = want
+
+					numeric := (lp - lm) / (2 * h)
+					if math.Abs(numeric-grads[i][j]) > 1e-6 {
+						t.Fatalf("gradient = %v, want %v", grads[i][j], numeric)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNetwork_ForwardInputs(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Name: "x", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	if _, err := net.ForwardInputs(map[string]*volume.Volume{"x": volume.NewVolume(volume.NewDimensions(1, 1, 2))}, false); err == nil {
+		t.Errorf("ForwardInputs() expected error for invalid dimensions")
+	}
+	if _, err := net.ForwardInputs(map[string]*volume.Volume{"x": volume.NewVolume(volume.NewDimensions(1, 1, 3))}, false); err != nil {
+		t.Errorf("ForwardInputs() error = %v", err)
+	}
+}
+
+func TestNetwork_ShareWeightsChain(t *testing.T) {
+	fc := func(name, share string) layers.LayerDef {
+		return layers.LayerDef{Name: name, Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(3), ShareWeightsWith: share}
+	}
+	tests := []struct {
+		name string
+		defs []layers.LayerDef
+	}{
+		{"owner first", []layers.LayerDef{fc("z", ""), fc("y", "z"), fc("x", "y")}},
+		{"owner last", []layers.LayerDef{fc("x", "y"), fc("y", "z"), fc("z", "")}},
+	}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := append([]layers.LayerDef{{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}}, tt.defs...)
+			net, err := NewNetwork(append(defs, layers.LayerDef{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}))
+			if err != nil {
+				t.Fatalf("NewNetwork() error = %v", err)
+			}
+
+			// z (3 filters + bias) and the regression fc (2 filters + bias)
+			if got := len(net.GetResponse()); got != 7 {
+				t.Fatalf("len(GetResponse()) = %v, want 7", got)
+			}
+
+			// with the identity as the shared weights each of the three
+			// layers passes its input through
+			resp := net.GetResponse()
+			for i := 0; i < 3; i++ {
+				for j := range resp[i].Weights {
+					resp[i].Weights[j] = 0
+				}
+				resp[i].Weights[i] = 1
+				resp[3].Weights[i] = 0
+			}
+			for _, n := range []Network{net, net.Clone()} {
+				out := x
+				for _, layer := range n.Layers()[:4] {
+					out = layer.Forward(out, false)
+				}
+				for i := 0; i < 3; i++ {
+					if out.GetByIndex(i) != x.GetByIndex(i) {
+						t.Fatalf("output = %v, want %v", out.Weights(), x.Weights())
+					}
+				}
+			}
+		})
+	}
+
+	_, err := NewNetwork([]layers.LayerDef{{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}, fc("x", "y"), fc("y", "x"),
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}})
+	if err == nil {
+		t.Error("NewNetwork() expected error for a cycle of shared weights")
+	}
+}
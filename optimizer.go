@@ -0,0 +1,420 @@
+package reticulum
+
+import (
+	"math"
+
+	"github.com/eliquious/reticulum/layers"
+)
+
+// Optimizer updates the parameters of a network from their gradients.
+type Optimizer interface {
+	// Init allocates the state of the optimizer for each set of parameters
+	// returned by Network.GetResponse. It is called once, before the first
+	// update.
+	Init(resp []layers.LayerResponse)
+
+	// Step updates the i-th set of parameters in place. The gradients are
+	// averaged over the batch and include the weight decay. k is the
+	// iteration counter of the trainer.
+	Step(i int, params, grads []float64, lr float64, k int)
+}
+
+// newOptimizer returns the optimizer for the training method of the options.
+func newOptimizer(opts *Options) Optimizer {
+	switch opts.Method {
+	case Adam:
+		return NewAdam(opts.Beta1, opts.Beta2, opts.Eps)
+	case Adagrad:
+		return NewAdagrad(opts.Eps)
+	case Adadelta:
+		return NewAdadelta(opts.Ro, opts.Eps)
+	case Windowgrad:
+		return NewWindowgrad(opts.Ro, opts.Eps)
+	case Netsterov:
+		return NewNesterov(opts.Momentum)
+	case AdamW:
+		return NewAdamW(opts.Beta1, opts.Beta2, opts.Eps, opts.WeightDecay)
+	case RMSProp:
+		return NewRMSProp(opts.Ro, opts.Eps)
+	case Nadam:
+		return NewNadam(opts.Beta1, opts.Beta2, opts.Eps)
+	case AMSGrad:
+		return NewAMSGrad(opts.Beta1, opts.Beta2, opts.Eps)
+	case LAMB:
+		return NewLAMB(opts.Beta1, opts.Beta2, opts.Eps, opts.WeightDecay)
+	default:
+		return NewSGD(opts.Momentum)
+	}
+}
+
+// accumulators returns a zeroed slice for each set of parameters.
+func accumulators(resp []layers.LayerResponse) [][]float64 {
+	sums := make([][]float64, len(resp))
+	for i, pg := range resp {
+		sums[i] = make([]float64, len(pg.Weights))
+	}
+	return sums
+}
+
+// NewSGD returns stochastic gradient descent. Momentum is disabled when 0.
+func NewSGD(momentum float64) Optimizer {
+	return &sgdOptimizer{momentum: momentum}
+}
+
+type sgdOptimizer struct {
+	momentum float64
+
+	// last update of each parameter
+	gsum [][]float64
+}
+
+func (o *sgdOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+}
+
+func (o *sgdOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi := o.gsum[i]
+	for j := range p {
+		if o.momentum > 0.0 {
+			// momentum update
+			dx := o.momentum*gsumi[j] - lr*g[j]
+
+			// back this up for next iteration of momentum
+			gsumi[j] = dx
+			p[j] += dx
+		} else {
+			// vanilla sgd
+			p[j] += -lr * g[j]
+		}
+	}
+}
+
+// NewNesterov returns gradient descent with Nesterov momentum.
+func NewNesterov(momentum float64) Optimizer {
+	return &nesterovOptimizer{momentum: momentum}
+}
+
+type nesterovOptimizer struct {
+	momentum float64
+	gsum     [][]float64
+}
+
+func (o *nesterovOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+}
+
+func (o *nesterovOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi := o.gsum[i]
+	for j := range p {
+		dx := gsumi[j]
+		gsumi[j] = gsumi[j]*o.momentum + lr*g[j]
+		dx = o.momentum*dx - (1.0+o.momentum)*gsumi[j]
+		p[j] += dx
+	}
+}
+
+// NewAdam returns the Adam optimizer.
+func NewAdam(beta1, beta2, eps float64) Optimizer {
+	return &adamOptimizer{moments{beta1: beta1, beta2: beta2, eps: eps}}
+}
+
+type adamOptimizer struct {
+	moments
+}
+
+func (o *adamOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	biasCorr1, biasCorr2 := o.update(i, g)
+	gsumi, xsumi := o.gsum[i], o.xsum[i]
+	for j := range p {
+		p[j] += -lr * (gsumi[j] / biasCorr1) / (math.Sqrt(xsumi[j]/biasCorr2) + o.eps)
+	}
+}
+
+// NewAdagrad returns the Adagrad optimizer.
+func NewAdagrad(eps float64) Optimizer {
+	return &adagradOptimizer{eps: eps}
+}
+
+type adagradOptimizer struct {
+	eps  float64
+	gsum [][]float64
+}
+
+func (o *adagradOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+}
+
+func (o *adagradOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi := o.gsum[i]
+	for j := range p {
+		gsumi[j] = gsumi[j] + g[j]*g[j]
+		p[j] += -lr / (math.Sqrt(gsumi[j]) + o.eps) * g[j]
+	}
+}
+
+// NewWindowgrad returns Adagrad with a moving window weighted average, so the
+// gradient is not accumulated over the entire history of the run. It's also
+// referred to as Idea #1 in the Zeiler paper on Adadelta.
+func NewWindowgrad(ro, eps float64) Optimizer {
+	return &windowgradOptimizer{ro: ro, eps: eps}
+}
+
+type windowgradOptimizer struct {
+	ro, eps float64
+	gsum    [][]float64
+}
+
+func (o *windowgradOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+}
+
+func (o *windowgradOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi := o.gsum[i]
+	for j := range p {
+		gsumi[j] = o.ro*gsumi[j] + (1-o.ro)*g[j]*g[j]
+
+		// eps added for better conditioning
+		p[j] += -lr / math.Sqrt(gsumi[j]+o.eps) * g[j]
+	}
+}
+
+// NewAdadelta returns the Adadelta optimizer. Adadelta does not use the
+// learning rate.
+func NewAdadelta(ro, eps float64) Optimizer {
+	return &adadeltaOptimizer{ro: ro, eps: eps}
+}
+
+type adadeltaOptimizer struct {
+	ro, eps float64
+	gsum    [][]float64
+	xsum    [][]float64
+}
+
+func (o *adadeltaOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+	o.xsum = accumulators(resp)
+}
+
+func (o *adadeltaOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi, xsumi := o.gsum[i], o.xsum[i]
+	for j := range p {
+		gsumi[j] = o.ro*gsumi[j] + (1-o.ro)*g[j]*g[j]
+		dx := -math.Sqrt((xsumi[j]+o.eps)/(gsumi[j]+o.eps)) * g[j]
+		xsumi[j] = o.ro*xsumi[j] + (1-o.ro)*dx*dx // yes, xsum lags behind gsum by 1.
+		p[j] += dx
+	}
+}
+
+// NewRMSProp returns the RMSProp optimizer, which divides the gradient by a
+// moving average of its magnitude.
+func NewRMSProp(ro, eps float64) Optimizer {
+	return &rmspropOptimizer{ro: ro, eps: eps}
+}
+
+type rmspropOptimizer struct {
+	ro, eps float64
+	gsum    [][]float64
+}
+
+func (o *rmspropOptimizer) Init(resp []layers.LayerResponse) {
+	o.gsum = accumulators(resp)
+}
+
+func (o *rmspropOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	gsumi := o.gsum[i]
+	for j := range p {
+		gsumi[j] = o.ro*gsumi[j] + (1-o.ro)*g[j]*g[j]
+		p[j] += -lr * g[j] / (math.Sqrt(gsumi[j]) + o.eps)
+	}
+}
+
+// moments keeps the first and second moment estimates shared by Adam and its
+// variants. They count their own updates, so the bias corrections don't
+// depend on the batch size.
+type moments struct {
+	beta1, beta2, eps float64
+
+	// first and second moment estimates
+	gsum [][]float64
+	xsum [][]float64
+
+	// L2 decay multiplier of each set of parameters
+	decayMul []float64
+
+	// number of updates
+	t int
+}
+
+func (m *moments) Init(resp []layers.LayerResponse) {
+	m.gsum = accumulators(resp)
+	m.xsum = accumulators(resp)
+	m.decayMul = make([]float64, len(resp))
+	for i, pg := range resp {
+		m.decayMul[i] = pg.L2DecayMul
+	}
+}
+
+// update updates the moment estimates of the i-th set of parameters and
+// returns the bias corrections of the current update.
+func (m *moments) update(i int, g []float64) (biasCorr1, biasCorr2 float64) {
+	if i == 0 {
+		m.t++
+	}
+	gsumi, xsumi := m.gsum[i], m.xsum[i]
+	for j := range g {
+		gsumi[j] = gsumi[j]*m.beta1 + (1-m.beta1)*g[j]
+		xsumi[j] = xsumi[j]*m.beta2 + (1-m.beta2)*g[j]*g[j]
+	}
+	return 1 - math.Pow(m.beta1, float64(m.t)), 1 - math.Pow(m.beta2, float64(m.t))
+}
+
+// NewAdamW returns Adam with decoupled weight decay. The parameters are
+// shrunk by lr * weightDecay on each update, scaled by the L2 decay
+// multiplier of the layer, independently of the L1 and L2 decay options
+// which are added to the gradient.
+func NewAdamW(beta1, beta2, eps, weightDecay float64) Optimizer {
+	return &adamwOptimizer{moments: moments{beta1: beta1, beta2: beta2, eps: eps}, weightDecay: weightDecay}
+}
+
+type adamwOptimizer struct {
+	moments
+	weightDecay float64
+}
+
+func (o *adamwOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	biasCorr1, biasCorr2 := o.update(i, g)
+	decay := o.weightDecay * o.decayMul[i]
+	gsumi, xsumi := o.gsum[i], o.xsum[i]
+	for j := range p {
+		mhat, vhat := gsumi[j]/biasCorr1, xsumi[j]/biasCorr2
+		p[j] += -lr * (mhat/(math.Sqrt(vhat)+o.eps) + decay*p[j])
+	}
+}
+
+// NewAMSGrad returns the AMSGrad variant of Adam, which normalizes by the
+// maximum of the second moment estimates seen so far.
+func NewAMSGrad(beta1, beta2, eps float64) Optimizer {
+	return &amsgradOptimizer{moments: moments{beta1: beta1, beta2: beta2, eps: eps}}
+}
+
+type amsgradOptimizer struct {
+	moments
+
+	// maximum second moment estimates
+	vmax [][]float64
+}
+
+func (o *amsgradOptimizer) Init(resp []layers.LayerResponse) {
+	o.moments.Init(resp)
+	o.vmax = accumulators(resp)
+}
+
+func (o *amsgradOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	biasCorr1, biasCorr2 := o.update(i, g)
+	gsumi, xsumi, vmaxi := o.gsum[i], o.xsum[i], o.vmax[i]
+	for j := range p {
+		vmaxi[j] = math.Max(vmaxi[j], xsumi[j])
+		p[j] += -lr * (gsumi[j] / biasCorr1) / (math.Sqrt(vmaxi[j]/biasCorr2) + o.eps)
+	}
+}
+
+// NewNadam returns Adam with Nesterov momentum.
+func NewNadam(beta1, beta2, eps float64) Optimizer {
+	return &nadamOptimizer{moments: moments{beta1: beta1, beta2: beta2, eps: eps}}
+}
+
+type nadamOptimizer struct {
+	moments
+}
+
+func (o *nadamOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	biasCorr1, biasCorr2 := o.update(i, g)
+	nextCorr1 := 1 - math.Pow(o.beta1, float64(o.t+1))
+	gsumi, xsumi := o.gsum[i], o.xsum[i]
+	for j := range p {
+		// look ahead with the momentum of the next update
+		mhat := o.beta1*gsumi[j]/nextCorr1 + (1-o.beta1)*g[j]/biasCorr1
+		p[j] += -lr * mhat / (math.Sqrt(xsumi[j]/biasCorr2) + o.eps)
+	}
+}
+
+// NewLAMB returns the LAMB optimizer. The Adam update, including the
+// decoupled weight decay, is rescaled for each set of parameters by the ratio
+// of the norm of the parameters to the norm of the update.
+func NewLAMB(beta1, beta2, eps, weightDecay float64) Optimizer {
+	return &lambOptimizer{moments: moments{beta1: beta1, beta2: beta2, eps: eps}, weightDecay: weightDecay}
+}
+
+type lambOptimizer struct {
+	moments
+	weightDecay float64
+
+	// update buffer
+	r []float64
+}
+
+func (o *lambOptimizer) Step(i int, p, g []float64, lr float64, k int) {
+	biasCorr1, biasCorr2 := o.update(i, g)
+	decay := o.weightDecay * o.decayMul[i]
+	gsumi, xsumi := o.gsum[i], o.xsum[i]
+	if cap(o.r) < len(p) {
+		o.r = make([]float64, len(p))
+	}
+	r := o.r[:len(p)]
+
+	var pnorm, rnorm float64
+	for j := range p {
+		mhat, vhat := gsumi[j]/biasCorr1, xsumi[j]/biasCorr2
+		r[j] = mhat/(math.Sqrt(vhat)+o.eps) + decay*p[j]
+		pnorm += p[j] * p[j]
+		rnorm += r[j] * r[j]
+	}
+
+	// trust ratio, left at 1 when either norm is zero
+	trust := 1.0
+	if pnorm > 0 && rnorm > 0 {
+		trust = math.Sqrt(pnorm) / math.Sqrt(rnorm)
+	}
+	for j := range p {
+		p[j] += -lr * trust * r[j]
+	}
+}
+
+// The optimizers implement encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler to save their state in checkpoints.
+
+func (o *sgdOptimizer) MarshalBinary() ([]byte, error)    { return encodeState(o.gsum) }
+func (o *sgdOptimizer) UnmarshalBinary(data []byte) error { return decodeState(data, &o.gsum) }
+
+func (o *nesterovOptimizer) MarshalBinary() ([]byte, error)    { return encodeState(o.gsum) }
+func (o *nesterovOptimizer) UnmarshalBinary(data []byte) error { return decodeState(data, &o.gsum) }
+
+func (o *adagradOptimizer) MarshalBinary() ([]byte, error)    { return encodeState(o.gsum) }
+func (o *adagradOptimizer) UnmarshalBinary(data []byte) error { return decodeState(data, &o.gsum) }
+
+func (o *windowgradOptimizer) MarshalBinary() ([]byte, error)    { return encodeState(o.gsum) }
+func (o *windowgradOptimizer) UnmarshalBinary(data []byte) error { return decodeState(data, &o.gsum) }
+
+func (o *adadeltaOptimizer) MarshalBinary() ([]byte, error) { return encodeState(o.gsum, o.xsum) }
+func (o *adadeltaOptimizer) UnmarshalBinary(data []byte) error {
+	return decodeState(data, &o.gsum, &o.xsum)
+}
+
+func (o *rmspropOptimizer) MarshalBinary() ([]byte, error)    { return encodeState(o.gsum) }
+func (o *rmspropOptimizer) UnmarshalBinary(data []byte) error { return decodeState(data, &o.gsum) }
+
+func (m *moments) MarshalBinary() ([]byte, error) {
+	return encodeState(m.gsum, m.xsum, m.decayMul, m.t)
+}
+
+func (m *moments) UnmarshalBinary(data []byte) error {
+	return decodeState(data, &m.gsum, &m.xsum, &m.decayMul, &m.t)
+}
+
+func (o *amsgradOptimizer) MarshalBinary() ([]byte, error) {
+	return encodeState(o.gsum, o.xsum, o.decayMul, o.t, o.vmax)
+}
+
+func (o *amsgradOptimizer) UnmarshalBinary(data []byte) error {
+	return decodeState(data, &o.gsum, &o.xsum, &o.decayMul, &o.t, &o.vmax)
+}
@@ -0,0 +1,189 @@
+package reticulum
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestOptimizers(t *testing.T) {
+	methods := []TrainingMethod{SGD, Adam, Adagrad, Adadelta, Windowgrad, Netsterov, AdamW, RMSProp, Nadam, AMSGrad, LAMB}
+
+	x := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{0.5, -0.3, 0.8}))
+	y := []float64{0.2, -0.4}
+	for _, m := range methods {
+		t.Run(string(m), func(t *testing.T) {
+			net, err := NewNetwork([]layers.LayerDef{
+				{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+				{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(4)},
+				{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)},
+			})
+			if err != nil {
+				t.Fatalf("NewNetwork() error = %v", err)
+			}
+			seedWeights(net, 1)
+
+			trainer := NewTrainer(net, WithMethod(m), WithLearningRate(0.01), WithWeightDecay(1e-4))
+			first := trainer.Train(x, RegressionLossFunc(y)).CostLost
+			var last float64
+			for i := 0; i < 200; i++ {
+				last = trainer.Train(x, RegressionLossFunc(y)).CostLost
+			}
+			if last >= first {
+				t.Errorf("loss = %v after training, want less than %v", last, first)
+			}
+		})
+	}
+}
+
+func TestAdam_Step(t *testing.T) {
+	opt := NewAdam(0.9, 0.999, 1e-8)
+	p := []float64{1.0}
+	opt.Init([]layers.LayerResponse{{Weights: p, Gradients: []float64{0}}})
+
+	// the bias corrections count the updates, not the samples in k
+	opt.Step(0, p, []float64{0.5}, 0.1, 5)
+	want := 1 - 0.1*0.5/(0.5+1e-8)
+	if math.Abs(p[0]-want) > 1e-12 {
+		t.Fatalf("first step = %v, want %v", p[0], want)
+	}
+
+	// m = 0.9*0.05 - 0.1 and v = 0.999*0.00025 + 0.001
+	opt.Step(0, p, []float64{-1.0}, 0.1, 10)
+	mhat, vhat := -0.055/(1-0.81), 0.00124975/(1-0.998001)
+	want -= 0.1 * mhat / (math.Sqrt(vhat) + 1e-8)
+	if math.Abs(p[0]-want) > 1e-12 {
+		t.Errorf("second step = %v, want %v", p[0], want)
+	}
+}
+
+func TestAdamW_Step(t *testing.T) {
+	opt := NewAdamW(0.9, 0.999, 1e-8, 0.01)
+	p, q := []float64{2.0}, []float64{2.0}
+	opt.Init([]layers.LayerResponse{
+		{Weights: p, Gradients: []float64{0}, L2DecayMul: 1},
+		{Weights: q, Gradients: []float64{0}, L2DecayMul: 0},
+	})
+
+	// the decay shrinks the parameters outside of the moments, scaled by the
+	// decay multiplier of the layer
+	opt.Step(0, p, []float64{0.5}, 0.1, 1)
+	opt.Step(1, q, []float64{0.5}, 0.1, 1)
+	adam := 0.5 / (0.5 + 1e-8)
+	if want := 2 - 0.1*(adam+0.01*2); math.Abs(p[0]-want) > 1e-12 {
+		t.Errorf("step with decay = %v, want %v", p[0], want)
+	}
+	if want := 2 - 0.1*adam; math.Abs(q[0]-want) > 1e-12 {
+		t.Errorf("step without decay = %v, want %v", q[0], want)
+	}
+}
+
+func TestLAMB_Step(t *testing.T) {
+	opt := NewLAMB(0.9, 0.999, 1e-8, 0.1)
+	p := []float64{3.0, 4.0}
+	opt.Init([]layers.LayerResponse{{Weights: p, Gradients: []float64{0, 0}, L2DecayMul: 1}})
+
+	// the first Adam update is the sign of the gradient, plus the decay
+	opt.Step(0, p, []float64{1.0, -2.0}, 0.1, 1)
+	r := []float64{1/(1+1e-8) + 0.1*3, -2/(2+1e-8) + 0.1*4}
+
+	// the trust ratio scales the update to the norm of the parameters, 5
+	trust := 5 / math.Sqrt(r[0]*r[0]+r[1]*r[1])
+	for j, want := range []float64{3 - 0.1*trust*r[0], 4 - 0.1*trust*r[1]} {
+		if math.Abs(p[j]-want) > 1e-12 {
+			t.Errorf("p[%d] = %v, want %v", j, p[j], want)
+		}
+	}
+}
+
+func TestRMSProp_Step(t *testing.T) {
+	opt := NewRMSProp(0.9, 1e-8)
+	p := []float64{1.0}
+	opt.Init([]layers.LayerResponse{{Weights: p, Gradients: []float64{0}}})
+
+	// the moving average is 0.1*0.25 and then 0.9*0.025 + 0.1*1
+	opt.Step(0, p, []float64{0.5}, 0.1, 1)
+	opt.Step(0, p, []float64{-1.0}, 0.1, 2)
+	want := 1 - 0.1*0.5/(math.Sqrt(0.025)+1e-8) + 0.1/(0.35+1e-8)
+	if math.Abs(p[0]-want) > 1e-12 {
+		t.Errorf("p = %v, want %v", p[0], want)
+	}
+}
+
+func TestNadam_Step(t *testing.T) {
+	opt := NewNadam(0.9, 0.999, 1e-8)
+	p := []float64{1.0}
+	opt.Init([]layers.LayerResponse{{Weights: p, Gradients: []float64{0}}})
+
+	// m = 0.05 is corrected with the bias of the next update, the gradient
+	// with the bias of the current one
+	opt.Step(0, p, []float64{0.5}, 0.1, 1)
+	mhat := 0.9*0.05/(1-0.81) + 0.1*0.5/0.1
+	want := 1 - 0.1*mhat/(0.5+1e-8)
+	if math.Abs(p[0]-want) > 1e-12 {
+		t.Errorf("p = %v, want %v", p[0], want)
+	}
+}
+
+func TestAMSGrad_Step(t *testing.T) {
+	opt := NewAMSGrad(0.9, 0.999, 1e-8)
+	p := []float64{1.0}
+	opt.Init([]layers.LayerResponse{{Weights: p, Gradients: []float64{0}}})
+
+	// v decays to 0.999*0.001 on the second step, the maximum stays at 0.001
+	opt.Step(0, p, []float64{1.0}, 0.1, 1)
+	opt.Step(0, p, []float64{0.0}, 0.1, 2)
+	want := 1 - 0.1*1/(1+1e-8) - 0.1*(0.09/0.19)/(math.Sqrt(0.001/0.001999)+1e-8)
+	if math.Abs(p[0]-want) > 1e-12 {
+		t.Errorf("p = %v, want %v", p[0], want)
+	}
+}
+
+// seedWeights replaces the random initialization of the network with a
+// deterministic one.
+func seedWeights(net Network, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for _, resp := range net.GetResponse() {
+		for j := range resp.Weights {
+			resp.Weights[j] = r.NormFloat64() * 0.5
+		}
+	}
+}
+
+func TestTrainer_TrainFullBatch(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 1)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(1)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// fit a smooth curve
+	var inputs []*volume.Volume
+	var targets []Target
+	for i := 0; i < 20; i++ {
+		x := -1 + 2*float64(i)/19
+		inputs = append(inputs, volume.NewVolume(volume.NewDimensions(1, 1, 1), volume.WithWeights([]float64{x})))
+		targets = append(targets, Target{Values: []float64{x * x * x}})
+	}
+	data := NewDataset(inputs, targets)
+
+	seedWeights(net, 1)
+	trainer := NewTrainer(net)
+	first := trainer.TrainFullBatch(data).TotalLoss
+	var last TrainingResults
+	for i := 0; i < 100; i++ {
+		last = trainer.TrainFullBatch(data)
+		if last.TotalLoss > first {
+			t.Fatalf("loss increased to %v from %v", last.TotalLoss, first)
+		}
+	}
+	if last.TotalLoss > first/100 {
+		t.Errorf("loss = %v after 100 iterations, want less than %v", last.TotalLoss, first/100)
+	}
+}
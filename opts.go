@@ -10,6 +10,11 @@ const (
 	Adadelta   TrainingMethod = "adadelta"
 	Windowgrad TrainingMethod = "windowgrad"
 	Netsterov  TrainingMethod = "netsterov"
+	AdamW      TrainingMethod = "adamw"
+	RMSProp    TrainingMethod = "rmsprop"
+	Nadam      TrainingMethod = "nadam"
+	AMSGrad    TrainingMethod = "amsgrad"
+	LAMB       TrainingMethod = "lamb"
 )
 
 type OptionFunc func(*Options)
@@ -26,6 +31,28 @@ type Options struct {
 	Eps      float64
 	Beta1    float64
 	Beta2    float64
+
+	// WeightDecay is the decoupled weight decay of AdamW and LAMB
+	WeightDecay float64
+
+	// Memory is the number of updates kept by L-BFGS in TrainFullBatch
+	Memory int
+
+	// Optimizer replaces the optimizer of the training method
+	Optimizer Optimizer
+
+	// Source generates the random numbers of training when set
+	Source *RandSource
+
+	// Callbacks are notified as training progresses
+	Callbacks []Callback
+
+	// Schedule adjusts the learning rate over the iterations
+	Schedule Schedule
+
+	// Gradient clipping thresholds, disabled when 0
+	ClipNorm  float64
+	ClipValue float64
 }
 
 func WithMethod(m TrainingMethod) OptionFunc {
@@ -73,3 +100,66 @@ func WithAdam(ro, beta1, beta2 float64) OptionFunc {
 		opts.Beta2 = beta2
 	}
 }
+
+// WithWeightDecay sets the decoupled weight decay of AdamW and LAMB. It is
+// applied to the parameters directly and is separate from WithDecay.
+func WithWeightDecay(wd float64) OptionFunc {
+	return func(opts *Options) {
+		opts.WeightDecay = wd
+	}
+}
+
+// WithMemory sets the number of updates kept by L-BFGS in TrainFullBatch.
+func WithMemory(m int) OptionFunc {
+	return func(opts *Options) {
+		opts.Memory = m
+	}
+}
+
+// WithOptimizer updates the parameters with a custom optimizer instead of
+// the optimizer of the training method.
+func WithOptimizer(o Optimizer) OptionFunc {
+	return func(opts *Options) {
+		opts.Optimizer = o
+	}
+}
+
+// WithSeed makes training reproducible. The dropouts and the shuffles of Fit
+// are drawn from a source seeded with seed, whose position is saved in
+// checkpoints. The weights are initialized when the network is created and
+// are not covered by the seed.
+func WithSeed(seed int64) OptionFunc {
+	return func(opts *Options) {
+		opts.Source = NewRandSource(seed)
+	}
+}
+
+// WithCallbacks notifies the callbacks as training progresses.
+func WithCallbacks(cbs ...Callback) OptionFunc {
+	return func(opts *Options) {
+		opts.Callbacks = append(opts.Callbacks, cbs...)
+	}
+}
+
+// WithSchedule adjusts the learning rate with the schedule. The schedule is
+// given the learning rate of the options as the base rate.
+func WithSchedule(s Schedule) OptionFunc {
+	return func(opts *Options) {
+		opts.Schedule = s
+	}
+}
+
+// WithGradientClipping rescales the gradients of the batch whenever their
+// global L2 norm across all parameters exceeds maxNorm.
+func WithGradientClipping(maxNorm float64) OptionFunc {
+	return func(opts *Options) {
+		opts.ClipNorm = maxNorm
+	}
+}
+
+// WithGradientValueClip clamps every gradient of the batch to [-v, v].
+func WithGradientValueClip(v float64) OptionFunc {
+	return func(opts *Options) {
+		opts.ClipValue = v
+	}
+}
@@ -0,0 +1,189 @@
+package reticulum
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/eliquious/reticulum/layers"
+)
+
+// ParallelTrainer trains mini-batches with several goroutines. Each worker
+// computes the gradients of a shard of the batch on a clone of the network,
+// the gradients are summed into the network and the parameters are updated
+// once per batch. Fit and FitStream train batches of BatchSize samples in
+// parallel, BatchSize is raised to the number of workers if it is smaller so
+// every worker has a sample. Train, TrainEmbedding and TrainFullBatch run in the calling
+// goroutine as with NewTrainer.
+type ParallelTrainer struct {
+	*trainer
+	workers []*worker
+}
+
+type worker struct {
+	net Network
+
+	// source of the dropouts, reseeded from the trainer before every batch
+	// so training stays reproducible. It is nil without a seed.
+	source *RandSource
+}
+
+// NewParallelTrainer creates a trainer with the given number of workers.
+func NewParallelTrainer(net Network, workers int, opts ...OptionFunc) *ParallelTrainer {
+	if workers <= 0 {
+		panic("parallel trainer requires at least one worker")
+	}
+
+	p := &ParallelTrainer{trainer: NewTrainer(net, opts...).(*trainer)}
+	if p.opts.BatchSize < workers {
+		p.opts.BatchSize = workers
+	}
+	for i := 0; i < workers; i++ {
+		w := &worker{net: net.Clone()}
+		if p.rand != nil {
+			w.source = NewRandSource(0)
+			random := rand.New(w.source)
+			for _, layer := range w.net.Layers() {
+				if r, ok := layer.(layers.RandomLayer); ok {
+					r.SetRand(random)
+				}
+			}
+		}
+		p.workers = append(p.workers, w)
+	}
+	return p
+}
+
+// TrainBatch trains the samples of the batch concurrently and updates the
+// parameters once with the gradients averaged over the batch. The update
+// includes the gradients of samples trained with Train since the last update.
+// The cost loss and the head losses of the results are the means over the
+// batch. The forward time contains both passes of the workers and the
+// backward time the reduction of the gradients and the update.
+func (p *ParallelTrainer) TrainBatch(batch []Sample, loss func(Target) LossFunc) (TrainingResults, error) {
+	if len(batch) == 0 {
+		return TrainingResults{}, errors.New("mini-batch cannot be empty")
+	}
+
+	start := time.Now()
+	shard := (len(batch) + len(p.workers) - 1) / len(p.workers)
+	active := p.workers[:(len(batch)+shard-1)/shard]
+	costs := make([]float64, len(active))
+	heads := make([]map[string]float64, len(active))
+	errs := make([]error, len(active))
+
+	var wg sync.WaitGroup
+	for i, w := range active {
+		if w.source != nil {
+			w.source.Seed(p.rand.Int63())
+		}
+
+		end := (i + 1) * shard
+		if end > len(batch) {
+			end = len(batch)
+		}
+		wg.Add(1)
+		go func(i int, w *worker, samples []Sample) {
+			defer wg.Done()
+			for _, s := range samples {
+				// the first layer writes gradients into its input
+				if errs[i] = s.clone().forward(w.net, true); errs[i] != nil {
+					return
+				}
+				costs[i] += loss(s.Target)(w.net)
+				for head, l := range w.net.HeadLosses() {
+					if heads[i] == nil {
+						heads[i] = make(map[string]float64)
+					}
+					heads[i][head] += l
+				}
+			}
+		}(i, w, batch[i*shard:end])
+	}
+	wg.Wait()
+	fwdTime := time.Now().Sub(start)
+	for _, err := range errs {
+		if err != nil {
+			// drop the gradients of the samples trained before the error
+			for _, w := range active {
+				for _, pg := range w.net.GetResponse() {
+					for j := range pg.Gradients {
+						pg.Gradients[j] = 0
+					}
+				}
+			}
+			return TrainingResults{}, err
+		}
+	}
+
+	// sum the gradients of the workers into the network
+	start = time.Now()
+	resp := p.net.GetResponse()
+	for _, w := range active {
+		for i, pg := range w.net.GetResponse() {
+			g := resp[i].Gradients
+			for j := range pg.Gradients {
+				g[j] += pg.Gradients[j]
+				pg.Gradients[j] = 0
+			}
+		}
+	}
+
+	// the rate of the last sample of the batch as with Train
+	p.k += len(batch) - 1
+	lr := p.learningRate()
+	p.lr = lr
+	p.k++
+	p.pending += len(batch)
+	l1DecayLoss, l2DecayLoss := p.update(lr, p.pending)
+	bwdTime := time.Now().Sub(start)
+
+	var costLoss float64
+	for _, c := range costs {
+		costLoss += c
+	}
+	costLoss /= float64(len(batch))
+
+	var headLosses map[string]float64
+	for _, h := range heads {
+		for head, l := range h {
+			if headLosses == nil {
+				headLosses = make(map[string]float64)
+			}
+			headLosses[head] += l / float64(len(batch))
+		}
+	}
+
+	results := TrainingResults{
+		ForwardTime:  fwdTime,
+		BackwardTime: bwdTime,
+		L1DecayLoss:  l1DecayLoss,
+		L2DecayLoss:  l2DecayLoss,
+		CostLost:     costLoss,
+		TotalLoss:    costLoss + l1DecayLoss + l2DecayLoss,
+		LearningRate: lr,
+		HeadLosses:   headLosses,
+	}
+	for _, cb := range p.opts.Callbacks {
+		cb.OnBatchEnd(p.net, results)
+	}
+	return results, nil
+}
+
+// Fit is the Fit of Trainer with every batch trained in parallel.
+func (p *ParallelTrainer) Fit(ctx context.Context, train, val Dataset, epochs int, opts ...FitOptionFunc) (History, error) {
+	fitOpts := p.fitOptions(opts)
+	return p.fit(ctx, p.datasetStream(train, fitOpts), val, epochs, fitOpts, p.trainBatch)
+}
+
+// FitStream is the FitStream of Trainer with every batch trained in parallel.
+func (p *ParallelTrainer) FitStream(ctx context.Context, stream func() Iterator, val Dataset, epochs int, opts ...FitOptionFunc) (History, error) {
+	return p.fit(ctx, stream, val, epochs, p.fitOptions(opts), p.trainBatch)
+}
+
+func (p *ParallelTrainer) trainBatch(batch []Sample, loss func(Target) LossFunc) (float64, error) {
+	results, err := p.TrainBatch(batch, loss)
+	return results.CostLost * float64(len(batch)), err
+}
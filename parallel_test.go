@@ -0,0 +1,169 @@
+package reticulum
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func sharedGraph(t *testing.T) Network {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "in", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "left", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "right", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3), ShareWeightsWith: "enc"}, Inputs: []string{"left"}},
+		{Def: layers.LayerDef{Name: "enc", Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(3)}, Inputs: []string{"in"}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"enc", "right"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+	seedWeights(net, 1)
+	return net
+}
+
+func TestParallelTrainer_TrainBatch(t *testing.T) {
+	var batch []Sample
+	for i := 0; i < 7; i++ {
+		x := float64(i) / 7
+		batch = append(batch, Sample{
+			Input:  volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{x, -x, 0.5})),
+			Target: Target{Values: []float64{math.Sin(x), math.Cos(x)}},
+		})
+	}
+
+	// the parallel update must match the sequential update of the same batch
+	for _, schedule := range []Schedule{nil, StepDecay(2, 0.5)} {
+		serial := NewTrainer(sharedGraph(t), WithMethod(Adam), WithBatchSize(len(batch)), WithDecay(1e-3, 1e-3), WithSchedule(schedule))
+		parallel := NewParallelTrainer(sharedGraph(t), 3, WithMethod(Adam), WithDecay(1e-3, 1e-3), WithSchedule(schedule))
+		for step := 0; step < 3; step++ {
+			var want TrainingResults
+			heads := map[string]float64{}
+			for _, s := range batch {
+				want = serial.Train(s.Input, TargetLossFunc(s.Target))
+				heads["out"] += want.HeadLosses["out"] / float64(len(batch))
+			}
+			got, err := parallel.TrainBatch(batch, TargetLossFunc)
+			if err != nil {
+				t.Fatalf("TrainBatch() error = %v", err)
+			}
+			if got.LearningRate != want.LearningRate {
+				t.Errorf("LearningRate = %v, want %v", got.LearningRate, want.LearningRate)
+			}
+			if math.Abs(got.HeadLosses["out"]-heads["out"]) > 1e-12 {
+				t.Errorf("HeadLosses = %v, want %v", got.HeadLosses, heads)
+			}
+		}
+
+		ws := flattenParams(serial.(*trainer).net.GetResponse())
+		wp := flattenParams(parallel.net.GetResponse())
+		for i := range ws {
+			if math.Abs(ws[i]-wp[i]) > 1e-12 {
+				t.Fatalf("weight %d = %v, want %v", i, wp[i], ws[i])
+			}
+		}
+	}
+}
+
+func TestParallelTrainer_Fit(t *testing.T) {
+	var samples []Sample
+	var inputs []*volume.Volume
+	var targets []Target
+	for i := 0; i < 10; i++ {
+		x := float64(i) / 10
+		s := Sample{
+			Input:  volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{x, -x, 0.5})),
+			Target: Target{Values: []float64{math.Sin(x), math.Cos(x)}},
+		}
+		samples = append(samples, s)
+		inputs, targets = append(inputs, s.Input), append(targets, s.Target)
+	}
+	data := NewDataset(inputs, targets)
+	stream := func() Iterator {
+		i := -1
+		return NewIterator(func() (Sample, error) {
+			if i++; i == len(samples) {
+				return Sample{}, io.EOF
+			}
+			return samples[i], nil
+		})
+	}
+
+	// batches of 4 samples and a last batch of 2, as with the serial trainer
+	serial := NewTrainer(sharedGraph(t), WithMethod(Adam), WithBatchSize(4), WithSchedule(StepDecay(3, 0.5)))
+	want, err := serial.Fit(context.Background(), data, data, 2, WithoutShuffle())
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+
+	fits := map[string]func(p *ParallelTrainer) (History, error){
+		"Fit": func(p *ParallelTrainer) (History, error) {
+			return p.Fit(context.Background(), data, data, 2, WithoutShuffle())
+		},
+		"FitStream": func(p *ParallelTrainer) (History, error) {
+			return p.FitStream(context.Background(), stream, data, 2)
+		},
+	}
+	for name, fit := range fits {
+		t.Run(name, func(t *testing.T) {
+			got, err := fit(NewParallelTrainer(sharedGraph(t), 3, WithMethod(Adam), WithBatchSize(4), WithSchedule(StepDecay(3, 0.5))))
+			if err != nil {
+				t.Fatalf("%s() error = %v", name, err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("len(history) = %v, want %v", len(got), len(want))
+			}
+			for i := range want {
+				if math.Abs(got[i].Loss-want[i].Loss) > 1e-12 || math.Abs(got[i].ValLoss-want[i].ValLoss) > 1e-12 ||
+					got[i].LearningRate != want[i].LearningRate {
+					t.Errorf("epoch %d = %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewParallelTrainer_BatchSize(t *testing.T) {
+	p := NewParallelTrainer(sharedGraph(t), 3)
+	if p.opts.BatchSize != 3 {
+		t.Errorf("BatchSize = %v, want 3", p.opts.BatchSize)
+	}
+}
+
+func TestParallelTrainer_TrainBatchPending(t *testing.T) {
+	var batch []Sample
+	for i := 0; i < 4; i++ {
+		x := float64(i) / 4
+		batch = append(batch, Sample{
+			Input:  volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{x, -x, 0.5})),
+			Target: Target{Values: []float64{math.Sin(x), math.Cos(x)}},
+		})
+	}
+
+	// a sample trained with Train is part of the next update
+	serial := NewTrainer(sharedGraph(t), WithBatchSize(len(batch)))
+	for _, s := range batch {
+		serial.Train(s.Input, TargetLossFunc(s.Target))
+	}
+	parallel := NewParallelTrainer(sharedGraph(t), 3, WithBatchSize(len(batch)))
+	parallel.Train(batch[0].Input, TargetLossFunc(batch[0].Target))
+	if _, err := parallel.TrainBatch(batch[1:], TargetLossFunc); err != nil {
+		t.Fatalf("TrainBatch() error = %v", err)
+	}
+
+	ws := flattenParams(serial.(*trainer).net.GetResponse())
+	wp := flattenParams(parallel.net.GetResponse())
+	for i := range ws {
+		if math.Abs(ws[i]-wp[i]) > 1e-12 {
+			t.Fatalf("weight %d = %v, want %v", i, wp[i], ws[i])
+		}
+	}
+
+	if _, err := parallel.TrainBatch(nil, TargetLossFunc); err == nil {
+		t.Error("TrainBatch() with an empty batch succeeded, want error")
+	}
+}
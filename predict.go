@@ -0,0 +1,66 @@
+package reticulum
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+// ClassScore is the score of a single class.
+type ClassScore struct {
+	Class int
+	Score float64
+}
+
+// Prediction is the output of a classification network for a single input.
+type Prediction struct {
+	// Class is the class with the highest score
+	Class int
+
+	// Scores contains the output of the network for each class. These are
+	// the probabilities for softmax and multi-label networks and the raw
+	// scores for svm networks.
+	Scores []float64
+
+	// Probabilities is set if the scores are probabilities
+	Probabilities []float64
+
+	// Ranked contains every class ordered from the highest to the lowest score
+	Ranked []ClassScore
+}
+
+// Top returns a copy of the k classes with the highest scores. k is clamped
+// to the number of classes.
+func (p *Prediction) Top(k int) []ClassScore {
+	if k > len(p.Ranked) {
+		k = len(p.Ranked)
+	} else if k < 0 {
+		k = 0
+	}
+	return append([]ClassScore(nil), p.Ranked[:k]...)
+}
+
+// newPrediction creates the prediction for the output of the last layer.
+func newPrediction(last layers.Layer, out *volume.Volume) (*Prediction, error) {
+	scores := append([]float64(nil), out.Weights()...)
+
+	p := &Prediction{Scores: scores}
+	switch last.Type() {
+	case layers.SoftMax, layers.MultiLabel:
+		p.Probabilities = scores
+	case layers.SVM:
+	default:
+		return nil, fmt.Errorf("prediction is not supported for %s layers", last.Type())
+	}
+
+	for i, s := range scores {
+		p.Ranked = append(p.Ranked, ClassScore{i, s})
+	}
+	sort.SliceStable(p.Ranked, func(i, j int) bool {
+		return p.Ranked[i].Score > p.Ranked[j].Score
+	})
+	p.Class = p.Ranked[0].Class
+	return p, nil
+}
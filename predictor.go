@@ -0,0 +1,50 @@
+package reticulum
+
+import (
+	"sync"
+
+	"github.com/eliquious/reticulum/volume"
+)
+
+// Predictor runs inference on a network from many goroutines. Each call
+// borrows a clone of the network from a pool, so concurrent calls don't share
+// activations. The clones share the weights of the network, which must not be
+// trained while the predictor is in use.
+type Predictor struct {
+	pool sync.Pool
+}
+
+// NewPredictor creates a predictor for the network.
+func NewPredictor(net Network) *Predictor {
+	p := &Predictor{}
+	p.pool.New = func() interface{} {
+		return net.Clone()
+	}
+	return p
+}
+
+// Infer returns a copy of the output of the network for the input.
+func (p *Predictor) Infer(vol *volume.Volume) *volume.Volume {
+	net := p.pool.Get().(Network)
+	defer p.pool.Put(net)
+	return net.Forward(vol, false).Clone()
+}
+
+// InferInputs returns a copy of the output of the network for the named
+// inputs of a graph network.
+func (p *Predictor) InferInputs(inputs map[string]*volume.Volume) (*volume.Volume, error) {
+	net := p.pool.Get().(Network)
+	defer p.pool.Put(net)
+	out, err := net.ForwardInputs(inputs, false)
+	if err != nil {
+		return nil, err
+	}
+	return out.Clone(), nil
+}
+
+// Predict returns the prediction of the network for the input.
+func (p *Predictor) Predict(vol *volume.Volume) (*Prediction, error) {
+	net := p.pool.Get().(Network)
+	defer p.pool.Put(net)
+	return net.Predict(vol)
+}
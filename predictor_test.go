@@ -0,0 +1,175 @@
+package reticulum
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestPredictor(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+		{Type: layers.Dropout, LayerConfig: &layers.DropoutLayerConfig{DropoutProbability: 0.5}},
+		{Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(4)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	var inputs []*volume.Volume
+	var want []int
+	for i := 0; i < 16; i++ {
+		x := float64(i) / 16
+		vol := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{x, 1 - x, x * x}))
+		inputs = append(inputs, vol)
+		p, err := net.Predict(vol)
+		if err != nil {
+			t.Fatalf("Predict() error = %v", err)
+		}
+		want = append(want, p.Class)
+	}
+
+	predictor := NewPredictor(net)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, vol := range inputs {
+				p, err := predictor.Predict(vol)
+				if err != nil {
+					t.Errorf("Predict() error = %v", err)
+					return
+				} else if p.Class != want[i] {
+					t.Errorf("Predict() class = %v, want %v", p.Class, want[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPredictor_Infer(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)},
+		{Type: layers.FullyConnected, Activation: layers.Tanh, LayerConfig: layers.NewFullyConnectedLayerConfig(8)},
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(2)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	var inputs []*volume.Volume
+	var want [][]float64
+	for i := 0; i < 16; i++ {
+		x := float64(i) / 16
+		vol := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{x, 1 - x, x * x}))
+		inputs = append(inputs, vol)
+		want = append(want, append([]float64(nil), net.Forward(vol, false).Weights()...))
+	}
+
+	predictor := NewPredictor(net)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, vol := range inputs {
+				if out := predictor.Infer(vol); !equalWeights(out.Weights(), want[i]) {
+					t.Errorf("Infer() = %v, want %v", out.Weights(), want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the output is a copy of the output of the clone
+	clone := net.Clone()
+	single := &Predictor{}
+	single.pool.New = func() interface{} { return clone }
+	single.Infer(inputs[0]).Weights()[0] = 100
+	if got := clone.Output().Weights(); !equalWeights(got, want[0]) {
+		t.Errorf("clone output = %v, want %v", got, want[0])
+	}
+}
+
+func TestPredictor_InferInputs(t *testing.T) {
+	net, err := NewGraphNetwork([]GraphNode{
+		{Def: layers.LayerDef{Name: "image", Type: layers.Input, Output: volume.NewDimensions(1, 1, 4)}},
+		{Def: layers.LayerDef{Name: "meta", Type: layers.Input, Output: volume.NewDimensions(1, 1, 3)}},
+		{Def: layers.LayerDef{Name: "features", Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)}, Inputs: []string{"image"}},
+		{Def: layers.LayerDef{Name: "join", Type: layers.Concat}, Inputs: []string{"features", "meta"}},
+		{Def: layers.LayerDef{Name: "out", Type: layers.SoftMax, LayerConfig: layers.NewSoftmaxLayerConfig(2)}, Inputs: []string{"join"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGraphNetwork() error = %v", err)
+	}
+
+	var inputs []map[string]*volume.Volume
+	var want [][]float64
+	for i := 0; i < 16; i++ {
+		x := float64(i) / 16
+		image := volume.NewVolume(volume.NewDimensions(1, 1, 4), volume.WithWeights([]float64{x, -x, 1 - x, x * x}))
+		meta := volume.NewVolume(volume.NewDimensions(1, 1, 3), volume.WithWeights([]float64{1 - x, x, 0.5}))
+		in := map[string]*volume.Volume{"image": image, "meta": meta}
+		out, err := net.ForwardInputs(in, false)
+		if err != nil {
+			t.Fatalf("ForwardInputs() error = %v", err)
+		}
+		inputs = append(inputs, in)
+		want = append(want, append([]float64(nil), out.Weights()...))
+	}
+
+	predictor := NewPredictor(net)
+	if _, err := predictor.InferInputs(map[string]*volume.Volume{"image": inputs[0]["image"]}); err == nil {
+		t.Errorf("InferInputs() expected error for missing input")
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, in := range inputs {
+				out, err := predictor.InferInputs(in)
+				if err != nil {
+					t.Errorf("InferInputs() error = %v", err)
+					return
+				} else if !equalWeights(out.Weights(), want[i]) {
+					t.Errorf("InferInputs() = %v, want %v", out.Weights(), want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the output is a copy of the output of the clone
+	clone := net.Clone()
+	single := &Predictor{}
+	single.pool.New = func() interface{} { return clone }
+	out, err := single.InferInputs(inputs[0])
+	if err != nil {
+		t.Fatalf("InferInputs() error = %v", err)
+	}
+	out.Weights()[0] = 100
+	if got := clone.Output().Weights(); !equalWeights(got, want[0]) {
+		t.Errorf("clone output = %v, want %v", got, want[0])
+	}
+}
+
+func equalWeights(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
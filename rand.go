@@ -0,0 +1,53 @@
+package reticulum
+
+import "math/rand"
+
+// RandSource is a seeded source of random numbers which counts the numbers
+// it has generated, so its state can be saved in a checkpoint and restored.
+type RandSource struct {
+	seed  int64
+	count uint64
+	src   rand.Source64
+}
+
+// NewRandSource returns a source seeded with seed.
+func NewRandSource(seed int64) *RandSource {
+	s := &RandSource{}
+	s.Seed(seed)
+	return s
+}
+
+func (s *RandSource) Int63() int64 {
+	s.count++
+	return s.src.Int63()
+}
+
+func (s *RandSource) Uint64() uint64 {
+	s.count++
+	return s.src.Uint64()
+}
+
+func (s *RandSource) Seed(seed int64) {
+	s.seed = seed
+	s.count = 0
+	s.src = rand.NewSource(seed).(rand.Source64)
+}
+
+// MarshalBinary encodes the seed and the count of the source.
+func (s *RandSource) MarshalBinary() ([]byte, error) {
+	return encodeState(s.seed, s.count)
+}
+
+// UnmarshalBinary reseeds the source and advances it to the saved count.
+func (s *RandSource) UnmarshalBinary(data []byte) error {
+	var seed int64
+	var count uint64
+	if err := decodeState(data, &seed, &count); err != nil {
+		return err
+	}
+	s.Seed(seed)
+	for ; s.count < count; s.count++ {
+		s.src.Uint64()
+	}
+	return nil
+}
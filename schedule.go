@@ -0,0 +1,100 @@
+package reticulum
+
+import "math"
+
+// Schedule computes the learning rate for iteration k of the trainer from
+// the base learning rate of the trainer options.
+type Schedule interface {
+	Rate(base float64, k int) float64
+}
+
+// ScheduleFunc is a function which implements Schedule.
+type ScheduleFunc func(base float64, k int) float64
+
+// Rate calls the function.
+func (fn ScheduleFunc) Rate(base float64, k int) float64 {
+	return fn(base, k)
+}
+
+// StepDecay multiplies the learning rate by gamma every step iterations.
+func StepDecay(step int, gamma float64) Schedule {
+	if step <= 0 {
+		panic("step decay requires a step greater than 0")
+	}
+	return ScheduleFunc(func(base float64, k int) float64 {
+		return base * math.Pow(gamma, float64(k/step))
+	})
+}
+
+// ExponentialDecay multiplies the learning rate by gamma every iteration.
+func ExponentialDecay(gamma float64) Schedule {
+	return ScheduleFunc(func(base float64, k int) float64 {
+		return base * math.Pow(gamma, float64(k))
+	})
+}
+
+// CosineAnnealing anneals the learning rate from the base rate to minRate
+// along a cosine over period iterations and then restarts. Each cycle is
+// mult times longer than the one before, a mult of 1 keeps the period fixed.
+func CosineAnnealing(period int, mult float64, minRate float64) Schedule {
+	if period <= 0 {
+		panic("cosine annealing requires a period greater than 0")
+	} else if mult < 1 {
+		panic("cosine annealing requires a period multiplier of at least 1")
+	}
+	return ScheduleFunc(func(base float64, k int) float64 {
+		// find the position within the current cycle
+		length := float64(period)
+		t := float64(k)
+		for t >= length {
+			t -= length
+			length *= mult
+		}
+		return minRate + (base-minRate)*(1+math.Cos(math.Pi*t/length))/2
+	})
+}
+
+// LinearWarmup increases the learning rate linearly from zero to the base
+// rate over the first steps iterations and then follows the next schedule,
+// which starts counting from zero once the warmup is complete. A nil
+// schedule keeps the base rate after the warmup.
+func LinearWarmup(steps int, next Schedule) Schedule {
+	if steps <= 0 {
+		panic("linear warmup requires steps greater than 0")
+	}
+	return ScheduleFunc(func(base float64, k int) float64 {
+		if k < steps {
+			return base * float64(k+1) / float64(steps)
+		} else if next == nil {
+			return base
+		}
+		return next.Rate(base, k-steps)
+	})
+}
+
+// OneCycle implements the one-cycle policy over total iterations. The
+// learning rate rises from the base rate to maxRate over the first warmup
+// fraction of the iterations and then anneals to base / 1e4. Both phases
+// follow a cosine.
+func OneCycle(total int, maxRate float64, warmup float64) Schedule {
+	if total <= 0 {
+		panic("one cycle requires a total greater than 0")
+	} else if warmup <= 0 || warmup >= 1 {
+		panic("one cycle warmup must be between 0 and 1")
+	}
+	up := int(float64(total) * warmup)
+	if up < 1 {
+		up = 1
+	}
+	return ScheduleFunc(func(base float64, k int) float64 {
+		anneal := func(from, to, t float64) float64 {
+			return to + (from-to)*(1+math.Cos(math.Pi*t))/2
+		}
+		if k < up {
+			return anneal(base, maxRate, float64(k)/float64(up))
+		} else if k >= total {
+			return base / 1e4
+		}
+		return anneal(maxRate, base/1e4, float64(k-up)/float64(total-up))
+	})
+}
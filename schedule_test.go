@@ -0,0 +1,39 @@
+package reticulum
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		k        int
+		want     float64
+	}{
+		{"step start", StepDecay(10, 0.5), 0, 1.0},
+		{"step first decay", StepDecay(10, 0.5), 10, 0.5},
+		{"step second decay", StepDecay(10, 0.5), 25, 0.25},
+		{"exponential", ExponentialDecay(0.9), 2, 0.81},
+		{"cosine start", CosineAnnealing(10, 1, 0), 0, 1.0},
+		{"cosine middle", CosineAnnealing(10, 1, 0), 5, 0.5},
+		{"cosine restart", CosineAnnealing(10, 1, 0), 10, 1.0},
+		{"cosine longer cycle", CosineAnnealing(10, 2, 0), 20, 0.5},
+		{"cosine min rate", CosineAnnealing(10, 1, 0.2), 5, 0.6},
+		{"warmup start", LinearWarmup(4, nil), 0, 0.25},
+		{"warmup end", LinearWarmup(4, nil), 3, 1.0},
+		{"warmup then decay", LinearWarmup(4, StepDecay(10, 0.5)), 14, 0.5},
+		{"one cycle start", OneCycle(100, 10, 0.3), 0, 1.0},
+		{"one cycle peak", OneCycle(100, 10, 0.3), 30, 10.0},
+		{"one cycle end", OneCycle(100, 10, 0.3), 100, 1e-4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Rate(1.0, tt.k); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Rate(1.0, %d) = %v, want %v", tt.k, got, tt.want)
+			}
+		})
+	}
+}
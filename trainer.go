@@ -1,14 +1,25 @@
 package reticulum
 
 import (
+	"context"
 	"github.com/eliquious/reticulum/layers"
 	"github.com/eliquious/reticulum/volume"
+	"io"
 	"math"
+	"math/rand"
 	"time"
 )
 
 type Trainer interface {
 	Train(vol *volume.Volume, lossFn LossFunc) TrainingResults
+	TrainInputs(inputs map[string]*volume.Volume, lossFn LossFunc) (TrainingResults, error)
+	TrainEmbedding(vols []*volume.Volume, lossFn EmbeddingLossFunc) TrainingResults
+	TrainFullBatch(data Dataset) TrainingResults
+	TrainMiniBatch(batch []Sample) (TrainingResults, error)
+	Fit(ctx context.Context, train, val Dataset, epochs int, opts ...FitOptionFunc) (History, error)
+	FitStream(ctx context.Context, stream func() Iterator, val Dataset, epochs int, opts ...FitOptionFunc) (History, error)
+	Checkpoint(w io.Writer) error
+	Restore(r io.Reader) error
 }
 
 func NewTrainer(net Network, opts ...OptionFunc) Trainer {
@@ -17,7 +28,7 @@ func NewTrainer(net Network, opts ...OptionFunc) Trainer {
 	}
 
 	// Read opts
-	baseOpts := &Options{Method: SGD, LearningRate: 0.01, BatchSize: 1, Momentum: 0.9, Ro: 0.95, Eps: 1e-8, Beta1: 0.9, Beta2: 0.999}
+	baseOpts := &Options{Method: SGD, LearningRate: 0.01, BatchSize: 1, Momentum: 0.9, Ro: 0.95, Eps: 1e-8, Beta1: 0.9, Beta2: 0.999, Memory: 10}
 	for _, optFn := range opts {
 		optFn(baseOpts)
 	}
@@ -27,7 +38,20 @@ func NewTrainer(net Network, opts ...OptionFunc) Trainer {
 	if _, ok := l[net.Size()-1].(layers.RegressionLossLayer); ok {
 		isRegression = true
 	}
-	return &trainer{net, baseOpts, 0, [][]float64{}, [][]float64{}, isRegression}
+	optimizer := baseOpts.Optimizer
+	if optimizer == nil {
+		optimizer = newOptimizer(baseOpts)
+	}
+	var random *rand.Rand
+	if baseOpts.Source != nil {
+		random = rand.New(baseOpts.Source)
+		for _, layer := range l {
+			if r, ok := layer.(layers.RandomLayer); ok {
+				r.SetRand(random)
+			}
+		}
+	}
+	return &trainer{net, baseOpts, 0, 0, optimizer, nil, isRegression, baseOpts.LearningRate, nil, random, nil, 0, nil, TrainingResults{}}
 }
 
 type trainer struct {
@@ -37,14 +61,36 @@ type trainer struct {
 	// iteration counter
 	k int
 
-	// last iteration gradients (used for momentum calculations)
-	gsum [][]float64
+	// samples whose gradients were accumulated since the last update
+	pending int
+
+	// updates the parameters at the end of each batch
+	optimizer Optimizer
 
-	// used in adam or adadelta
-	xsum [][]float64
+	// batch averaged gradients passed to the optimizer
+	grads [][]float64
 
 	// check if regression is used
 	regression bool
+
+	// learning rate of the last iteration
+	lr float64
+
+	// curvature history of full batch training
+	lbfgs *lbfgs
+
+	// random numbers drawn from the seeded source, nil without a seed
+	rand *rand.Rand
+
+	// clones of the network for the inputs of TrainEmbedding
+	embedders []Network
+
+	// epochs completed by Fit and the epoch in progress, nil between epochs
+	epoch    int
+	progress *epochProgress
+
+	// results of the last iteration of an incomplete batch
+	last TrainingResults
 }
 
 type LossFunc func(net Network) float64
@@ -61,130 +107,206 @@ func RegressionLossFunc(y []float64) LossFunc {
 	}
 }
 
+// TargetLossFunc trains the first head of the network on the target.
+func TargetLossFunc(target Target) LossFunc {
+	return func(net Network) float64 {
+		return net.BackwardHeads(HeadLoss{Head: net.Heads()[0], Weight: 1.0, Target: target})
+	}
+}
+
+// MultiLabelLossFunc trains a multi-label network on the probability of each label.
+func MultiLabelLossFunc(y []float64) LossFunc {
+	return TargetLossFunc(Target{Values: y})
+}
+
+// DistributionLossFunc trains a softmax network against the probability
+// distribution p. For distillation p is the output of the teacher network for
+// the same input, e.g. teacher.Forward(vol, false).Weights().
+func DistributionLossFunc(p []float64) LossFunc {
+	return TargetLossFunc(Target{Values: p})
+}
+
+// OutputLoss computes a loss directly from the output volume of the network.
+// It must write the gradient of the loss with respect to each output into the
+// gradients of out, which are zeroed before it is called.
+type OutputLoss func(out *volume.Volume) float64
+
+// OutputLossFunc trains a network with a custom loss. The gradient written by
+// the loss is propagated through every layer of the network, so the network
+// must end without a loss layer.
+func OutputLossFunc(loss OutputLoss) LossFunc {
+	return func(net Network) float64 {
+		out := net.Output()
+		out.ZeroGrad()
+		cost := loss(out)
+		net.BackwardOutput()
+		return cost
+	}
+}
+
+// MultiTaskLossFunc trains several heads of the network at once. The gradients
+// of the heads are scaled by their weights and combined in one backward pass.
+func MultiTaskLossFunc(heads ...HeadLoss) LossFunc {
+	return func(net Network) float64 {
+		return net.BackwardHeads(heads...)
+	}
+}
+
 func (t *trainer) Train(vol *volume.Volume, lossFunc LossFunc) TrainingResults {
 	start := time.Now()
 	t.net.Forward(vol, true)
-	fwdTime := time.Now().Sub(start)
+	return t.train(time.Now().Sub(start), lossFunc)
+}
 
-	start = time.Now()
+// TrainInputs is Train for networks with several named inputs. An error is
+// returned if the inputs do not match the inputs of the network.
+func (t *trainer) TrainInputs(inputs map[string]*volume.Volume, lossFunc LossFunc) (TrainingResults, error) {
+	start := time.Now()
+	if _, err := t.net.ForwardInputs(inputs, true); err != nil {
+		return TrainingResults{}, err
+	}
+	return t.train(time.Now().Sub(start), lossFunc), nil
+}
+
+// train runs the backward pass of the last forward pass and steps the
+// trainer.
+func (t *trainer) train(fwdTime time.Duration, lossFunc LossFunc) TrainingResults {
+	start := time.Now()
 	costLoss := lossFunc(t.net)
 	bwdTime := time.Now().Sub(start)
+	headLosses := t.net.HeadLosses()
 
+	l1DecayLoss, l2DecayLoss := t.step()
+	results := TrainingResults{
+		ForwardTime:  fwdTime,
+		BackwardTime: bwdTime,
+		L1DecayLoss:  l1DecayLoss,
+		L2DecayLoss:  l2DecayLoss,
+		CostLost:     costLoss,
+		TotalLoss:    costLoss + l1DecayLoss + l2DecayLoss,
+		LearningRate: t.lr,
+		HeadLosses:   headLosses,
+	}
+	t.batchEnd(results)
+	return results
+}
+
+// step advances the iteration counter and updates the parameters of the
+// network at the end of every batch.
+func (t *trainer) step() (l1DecayLoss, l2DecayLoss float64) {
+	lr := t.learningRate()
+	t.lr = lr
 	t.k++
-	var l1DecayLoss, l2DecayLoss float64
-	if t.k%t.opts.BatchSize == 0 {
-		pgList := t.net.GetResponse()
-
-		// initialize lists for accumulators. Will only be done once on first iteration
-		if len(t.gsum) == 0 && t.opts.Method == SGD || t.opts.Momentum > 0.0 {
-			for i := 0; i < len(pgList); i++ {
-				t.gsum = append(t.gsum, make([]float64, len(pgList[i].Weights)))
-				if t.opts.Method == Adam || t.opts.Method == Adadelta {
-					t.xsum = append(t.xsum, make([]float64, len(pgList[i].Weights)))
-				} else {
-					t.xsum = append(t.xsum, []float64{})
-				}
+	t.pending++
+	if t.pending == t.opts.BatchSize {
+		l1DecayLoss, l2DecayLoss = t.update(lr, t.opts.BatchSize)
+	}
+	return l1DecayLoss, l2DecayLoss
+}
+
+// flush updates the parameters with the gradients of an incomplete batch and
+// notifies the callbacks with the results of its last iteration.
+func (t *trainer) flush() {
+	if t.pending > 0 {
+		results := t.last
+		results.LearningRate = t.lr
+		results.L1DecayLoss, results.L2DecayLoss = t.update(t.lr, t.pending)
+		results.TotalLoss = results.CostLost + results.L1DecayLoss + results.L2DecayLoss
+		t.batchEnd(results)
+	}
+}
+
+// update updates the parameters from the gradients accumulated over
+// batchSize samples and zeroes the gradients.
+func (t *trainer) update(lr float64, batchSize int) (l1DecayLoss, l2DecayLoss float64) {
+	t.pending = 0
+	pgList := t.net.GetResponse()
+	t.clipGradients(pgList, batchSize)
+
+	// initialize the optimizer state. Will only be done once on first iteration
+	if t.grads == nil {
+		t.optimizer.Init(pgList)
+		t.grads = accumulators(pgList)
+	}
+
+	// perform an update for all sets of weights
+	for i, pg := range pgList {
+		p := pg.Weights
+		g := pg.Gradients
+		gi := t.grads[i]
+
+		// learning rate for some parameters.
+		l1DecayMul, l2DecayMul := pg.L1DecayMul, pg.L2DecayMul
+		l1Decay := t.opts.L1Decay * l1DecayMul
+		l2Decay := t.opts.L2Decay * l2DecayMul
+
+		for j := 0; j < len(p); j++ {
+			// accumulate weight decay loss
+			l2DecayLoss += l2Decay * p[j] * p[j] / 2.0
+			l1DecayLoss += l1Decay * math.Abs(p[j])
+			l1Grad, l2Grad := l1Decay, l2Decay*p[j]
+			if p[j] <= 0 {
+				l1Grad *= -1
 			}
+
+			// raw batch gradient
+			gi[j] = (l2Grad + l1Grad + g[j]) / float64(batchSize)
+
+			// zero out gradient so that we can begin accumulating anew
+			g[j] = 0.0
 		}
+		t.optimizer.Step(i, p, gi, lr, t.k)
+	}
+	return l1DecayLoss, l2DecayLoss
+}
 
-		// perform an update for all sets of weights
-		for i, pg := range pgList {
-			p := pg.Weights
-			g := pg.Gradients
-
-			// learning rate for some parameters.
-			l1DecayMul, l2DecayMul := pg.L1DecayMul, pg.L2DecayMul
-			l1Decay := t.opts.L1Decay * l1DecayMul
-			l2Decay := t.opts.L2Decay * l2DecayMul
-
-			for j := 0; j < len(p); j++ {
-				// accumulate weight decay loss
-				l2DecayLoss += l2Decay * p[j] * p[j] / 2.0
-				l1DecayLoss += l1Decay * math.Abs(p[j])
-				l1Grad, l2Grad := l1Decay, l2Decay*p[j]
-				if p[j] <= 0 {
-					l1Grad *= -1
-				}
+// clipGradients clips the gradients accumulated over the batch. The
+// thresholds apply to the batch averaged gradients, before weight decay.
+// Values are clipped first and the global norm second.
+func (t *trainer) clipGradients(pgList []layers.LayerResponse, size int) {
+	batchSize := float64(size)
+	if t.opts.ClipValue > 0 {
+		limit := t.opts.ClipValue * batchSize
+		for _, pg := range pgList {
+			for j, g := range pg.Gradients {
+				pg.Gradients[j] = math.Max(-limit, math.Min(limit, g))
+			}
+		}
+	}
 
-				// raw batch gradient
-				gij := (l2Grad + l1Grad + g[j]) / float64(t.opts.BatchSize)
-
-				meth := t.opts.Method
-				gsumi, xsumi := t.gsum[i], t.xsum[i]
-				if meth == Adam {
-
-					// update biased first moment estimate
-					gsumi[j] = gsumi[j]*t.opts.Beta1 + (1-t.opts.Beta1)*gij
-
-					// update biased second moment estimate
-					xsumi[j] = xsumi[j]*t.opts.Beta2 + (1-t.opts.Beta2)*gij*gij
-
-					// correct bias first moment estimate
-					biasCorr1 := gsumi[j] * (1 - math.Pow(t.opts.Beta1, float64(t.k)))
-
-					// correct bias second moment estimate
-					biasCorr2 := xsumi[j] * (1 - math.Pow(t.opts.Beta2, float64(t.k)))
-
-					dx := -t.opts.LearningRate * biasCorr1 / (math.Sqrt(biasCorr2) + t.opts.Eps)
-					p[j] += dx
-				} else if meth == Adagrad {
-					// update biased first moment estimate
-					gsumi[j] = gsumi[j] + gij*gij
-
-					dx := -t.opts.LearningRate / (math.Sqrt(gsumi[j]) + t.opts.Eps) * gij
-					p[j] += dx
-				} else if meth == Windowgrad {
-					// this is adagrad but with a moving window weighted average
-					// so the gradient is not accumulated over the entire history of the run.
-					// it's also referred to as Idea #1 in Zeiler paper on Adadelta. Seems reasonable to me!
-					gsumi[j] = t.opts.Ro*gsumi[j] + (1-t.opts.Ro)*gij*gij
-
-					// eps added for better conditioning
-					dx := -t.opts.LearningRate / math.Sqrt(gsumi[j]+t.opts.Eps) * gij
-					p[j] += dx
-				} else if meth == Adadelta {
-					gsumi[j] = t.opts.Ro*gsumi[j] + (1-t.opts.Ro)*gij*gij
-					dx := -math.Sqrt((xsumi[j]+t.opts.Eps)/(gsumi[j]+t.opts.Eps)) * gij
-					xsumi[j] = t.opts.Ro*xsumi[j] + (1-t.opts.Ro)*dx*dx // yes, xsum lags behind gsum by 1.
-					p[j] += dx
-				} else if meth == Netsterov {
-					dx := gsumi[j]
-					gsumi[j] = gsumi[j]*t.opts.Momentum + t.opts.LearningRate*gij
-					dx = t.opts.Momentum*dx - (1.0+t.opts.Momentum)*gsumi[j]
-					p[j] += dx
-				} else {
-
-					// Assume SGD
-					if t.opts.Momentum > 0.0 {
-						// momentum update
-
-						// step
-						dx := t.opts.Momentum*gsumi[j] - t.opts.LearningRate*gij
-
-						// back this up for next iteration of momentum
-						gsumi[j] = dx
-
-						// apply corrected gradient
-						p[j] += dx
-					} else {
-						// vanilla sgd
-						p[j] += -t.opts.LearningRate * gij
-					}
-				}
+	if t.opts.ClipNorm > 0 {
+		var sum float64
+		for _, pg := range pgList {
+			for _, g := range pg.Gradients {
+				sum += (g / batchSize) * (g / batchSize)
+			}
+		}
 
-				// zero out gradient so that we can begin accumulating anew
-				g[j] = 0.0
+		norm := math.Sqrt(sum)
+		if norm > t.opts.ClipNorm {
+			scale := t.opts.ClipNorm / norm
+			for _, pg := range pgList {
+				for j := range pg.Gradients {
+					pg.Gradients[j] *= scale
+				}
 			}
 		}
 	}
-	return TrainingResults{
-		ForwardTime:  fwdTime,
-		BackwardTime: bwdTime,
-		L1DecayLoss:  l1DecayLoss,
-		L2DecayLoss:  l2DecayLoss,
-		CostLost:     costLoss,
-		TotalLoss:    costLoss + l1DecayLoss + l2DecayLoss,
+}
+
+// learningRate returns the learning rate for the current iteration, scaled by
+// the callbacks which implement RateScaler.
+func (t *trainer) learningRate() float64 {
+	lr := t.opts.LearningRate
+	if t.opts.Schedule != nil {
+		lr = t.opts.Schedule.Rate(lr, t.k)
+	}
+	for _, cb := range t.opts.Callbacks {
+		if s, ok := cb.(RateScaler); ok {
+			lr = s.ScaleRate(lr)
+		}
 	}
+	return lr
 }
 
 type TrainingResults struct {
@@ -194,4 +316,9 @@ type TrainingResults struct {
 	L2DecayLoss  float64
 	CostLost     float64
 	TotalLoss    float64
+	LearningRate float64
+
+	// HeadLosses contains the unweighted loss of each head when the network
+	// was trained with MultiTaskLossFunc.
+	HeadLosses map[string]float64
 }
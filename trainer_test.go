@@ -0,0 +1,50 @@
+package reticulum
+
+import (
+	"math"
+	"testing"
+
+	"github.com/eliquious/reticulum/layers"
+	"github.com/eliquious/reticulum/volume"
+)
+
+func TestTrainer_ClipGradients(t *testing.T) {
+	net, err := NewNetwork([]layers.LayerDef{
+		{Type: layers.Input, Output: volume.NewDimensions(1, 1, 2)},
+		{Type: layers.FullyConnected, LayerConfig: layers.NewFullyConnectedLayerConfig(2)},
+		{Type: layers.Regression, LayerConfig: layers.NewRegressionLayerConfig(1)},
+	})
+	if err != nil {
+		t.Fatalf("NewNetwork() error = %v", err)
+	}
+
+	// the gradients are sums over a batch of two samples
+	tests := []struct {
+		name  string
+		opts  []OptionFunc
+		grads [][]float64
+		want  [][]float64
+	}{
+		{"value", []OptionFunc{WithGradientValueClip(1)}, [][]float64{{3, -1}, {-5, 0.5}}, [][]float64{{2, -1}, {-2, 0.5}}},
+		{"norm", []OptionFunc{WithGradientClipping(1)}, [][]float64{{6}, {8}}, [][]float64{{1.2}, {1.6}}},
+		{"norm below", []OptionFunc{WithGradientClipping(10)}, [][]float64{{6}, {8}}, [][]float64{{6}, {8}}},
+		{"value then norm", []OptionFunc{WithGradientValueClip(2), WithGradientClipping(2)}, [][]float64{{6}, {-8}}, [][]float64{{2 * math.Sqrt2}, {-2 * math.Sqrt2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp []layers.LayerResponse
+			for _, g := range tt.grads {
+				resp = append(resp, layers.LayerResponse{Gradients: append([]float64(nil), g...)})
+			}
+
+			NewTrainer(net, tt.opts...).(*trainer).clipGradients(resp, 2)
+			for i := range resp {
+				for j, g := range resp[i].Gradients {
+					if math.Abs(g-tt.want[i][j]) > 1e-12 {
+						t.Errorf("gradient[%d][%d] = %v, want %v", i, j, g, tt.want[i][j])
+					}
+				}
+			}
+		})
+	}
+}
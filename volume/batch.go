@@ -0,0 +1,84 @@
+package volume
+
+// Batch is a mini-batch of N volumes with the same dimensions. The weights
+// and gradients of the volumes are stored contiguously, one volume after the
+// other.
+type Batch struct {
+	n   int
+	dim Dimensions
+	w   []float64
+	dw  []float64
+}
+
+// NewBatch creates a batch of n volumes with zero weights and gradients.
+func NewBatch(n int, dim Dimensions) *Batch {
+	size := n * dim.Size()
+	return &Batch{n, dim, make([]float64, size), make([]float64, size)}
+}
+
+// BatchOf creates a batch with copies of the weights of the volumes, which
+// must all have the same dimensions.
+func BatchOf(vols ...*Volume) *Batch {
+	if len(vols) == 0 {
+		panic("Invalid batch: at least one volume is required")
+	}
+
+	b := NewBatch(len(vols), vols[0].dim)
+	for i, v := range vols {
+		if v.dim != b.dim {
+			panic("Invalid batch: volumes have different dimensions")
+		}
+		copy(b.At(i).w, v.w)
+	}
+	return b
+}
+
+// N returns the number of volumes in the batch.
+func (b *Batch) N() int {
+	return b.n
+}
+
+// Dimensions returns the Dimensions of each volume in the batch.
+func (b *Batch) Dimensions() Dimensions {
+	return b.dim
+}
+
+// At returns the i-th volume of the batch. The volume shares the weights and
+// gradients of the batch.
+func (b *Batch) At(i int) *Volume {
+	size := b.dim.Size()
+	return &Volume{b.dim, b.w[i*size : (i+1)*size], b.dw[i*size : (i+1)*size]}
+}
+
+// Flat returns a single volume of depth N times the size of each volume,
+// sharing the weights and gradients of the batch. It is used by element-wise
+// layers to process the whole batch at once.
+func (b *Batch) Flat() *Volume {
+	return &Volume{Dimensions{1, 1, len(b.w)}, b.w, b.dw}
+}
+
+// ZeroGrad sets the gradients to 0.
+func (b *Batch) ZeroGrad() {
+	for i := range b.dw {
+		b.dw[i] = 0.0
+	}
+}
+
+// Weights returns the weights of all the volumes.
+func (b *Batch) Weights() []float64 {
+	return b.w
+}
+
+// Gradients returns the gradients of all the volumes.
+func (b *Batch) Gradients() []float64 {
+	return b.dw
+}
+
+// AsBatch returns a batch of n volumes of the given dimensions which shares
+// the weights and gradients of v. It is the inverse of Batch.Flat.
+func (v *Volume) AsBatch(n int, dim Dimensions) *Batch {
+	if n*dim.Size() != len(v.w) {
+		panic("Invalid batch: size does not match the volume")
+	}
+	return &Batch{n, dim, v.w, v.dw}
+}
@@ -205,6 +205,12 @@ func (v *Volume) Clone() *Volume {
 	return vol
 }
 
+// CloneShared creates a Volume which shares the weights of v and has
+// gradients of its own.
+func (v *Volume) CloneShared() *Volume {
+	return &Volume{v.dim, v.w, make([]float64, len(v.dw))}
+}
+
 // CloneAndZero creates a Volume of the same size but with zero weights and gradients.
 func (v *Volume) CloneAndZero() *Volume {
 	return NewVolume(v.dim, WithZeros())